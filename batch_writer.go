@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"sync"
+	"time"
+	"context"
+)
+
+// Buffers Set, Del and Ttl commands and writes them to one of the pool's
+// clients as a single pipeline once MaxItems are buffered or Interval has
+// elapsed since the last write. A BatchWriter is safe for concurrent use.
+type BatchWriter struct {
+	pool *PaperPool
+	config BatchWriterConfig
+
+	queue chan batchItem
+	flushes chan chan struct{}
+	done chan struct{}
+
+	closed bool
+	closed_lock sync.RWMutex
+}
+
+type BatchWriterConfig struct {
+	// The number of buffered commands which triggers a write. Once this
+	// many commands are waiting to be written, further commands block
+	// until there is room.
+	MaxItems int
+
+	// The longest a command is buffered before being written.
+	Interval time.Duration
+
+	// Called from the writer's goroutine with the key and error of each
+	// command which failed.
+	OnError func(key string, err error)
+}
+
+type batchItem struct {
+	key string
+	writer *sheetWriter
+}
+
+const DefaultBatchMaxItems = 128
+const DefaultBatchInterval = 10 * time.Millisecond
+
+// Creates a batch writer which writes to the pool's clients. A zero
+// MaxItems or Interval uses the default.
+func (pool *PaperPool) BatchWriter(config BatchWriterConfig) *BatchWriter {
+	if config.MaxItems <= 0 {
+		config.MaxItems = DefaultBatchMaxItems
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = DefaultBatchInterval
+	}
+
+	batch := &BatchWriter {
+		pool: pool,
+		config: config,
+
+		queue: make(chan batchItem, config.MaxItems),
+		flushes: make(chan chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go batch.run()
+
+	return batch
+}
+
+// Buffers setting the supplied key, value, and TTL.
+func (batch *BatchWriter) Set(key string, value string, ttl uint32) error {
+	return batch.enqueue(key, setWriter(key, value, ttl))
+}
+
+// Buffers setting the supplied key, value as bytes, and TTL.
+func (batch *BatchWriter) SetBytes(key string, value []byte, ttl uint32) error {
+	return batch.enqueue(key, setBytesWriter(key, value, ttl))
+}
+
+// Buffers deleting the value of the supplied key.
+func (batch *BatchWriter) Del(key string) error {
+	return batch.enqueue(key, delWriter(key))
+}
+
+// Buffers setting the TTL of the supplied key.
+func (batch *BatchWriter) Ttl(key string, ttl uint32) error {
+	return batch.enqueue(key, ttlWriter(key, ttl))
+}
+
+// Writes every command buffered before the call and waits for their
+// responses.
+func (batch *BatchWriter) Flush() error {
+	batch.closed_lock.RLock()
+	defer batch.closed_lock.RUnlock()
+
+	if batch.closed {
+		return PaperErrorBatchWriterClosed
+	}
+
+	flushed := make(chan struct{})
+	batch.flushes <- flushed
+	<-flushed
+
+	return nil
+}
+
+// Writes every buffered command and stops the writer. Commands buffered
+// after the writer is closed return PaperErrorBatchWriterClosed.
+func (batch *BatchWriter) Close() {
+	batch.closed_lock.Lock()
+
+	if batch.closed {
+		batch.closed_lock.Unlock()
+		return
+	}
+
+	batch.closed = true
+	close(batch.queue)
+	batch.closed_lock.Unlock()
+
+	<-batch.done
+}
+
+func (batch *BatchWriter) enqueue(key string, writer *sheetWriter) error {
+	batch.closed_lock.RLock()
+	defer batch.closed_lock.RUnlock()
+
+	if batch.closed {
+		return PaperErrorBatchWriterClosed
+	}
+
+	batch.queue <- batchItem { key, writer }
+
+	return nil
+}
+
+func (batch *BatchWriter) run() {
+	defer close(batch.done)
+
+	ticker := time.NewTicker(batch.config.Interval)
+	defer ticker.Stop()
+
+	items := make([]batchItem, 0, batch.config.MaxItems)
+
+	for {
+		select {
+			case item, ok := <-batch.queue:
+				if !ok {
+					batch.write(items)
+					return
+				}
+
+				items = append(items, item)
+
+				if len(items) >= batch.config.MaxItems {
+					items = batch.write(items)
+				}
+
+			case flushed := <-batch.flushes:
+				// anything sent before the flush was requested is already
+				// in the queue's buffer
+				for i := len(batch.queue); i > 0; i-- {
+					items = append(items, <-batch.queue)
+				}
+
+				items = batch.write(items)
+				close(flushed)
+
+			case <-ticker.C:
+				items = batch.write(items)
+		}
+	}
+}
+
+// Writes the items as one pipeline and returns the emptied slice.
+func (batch *BatchWriter) write(items []batchItem) []batchItem {
+	if len(items) == 0 {
+		return items
+	}
+
+	commands := make([]pipelineCommand, len(items))
+
+	for i, item := range items {
+		commands[i] = pipelineCommand { item.writer, nil }
+	}
+
+	results := batch.pool.execPipeline(context.Background(), commands)
+
+	if batch.config.OnError != nil {
+		for i, result := range results {
+			if result.Err != nil {
+				batch.config.OnError(items[i].key, result.Err)
+			}
+		}
+	}
+
+	return items[:0]
+}
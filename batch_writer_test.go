@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchWriter(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+
+	var lock sync.Mutex
+	errs := map[string]error {}
+
+	batch := pool.BatchWriter(BatchWriterConfig {
+		MaxItems: 2,
+		Interval: time.Hour,
+
+		OnError: func(key string, err error) {
+			lock.Lock()
+			errs[key] = err
+			lock.Unlock()
+		},
+	})
+
+	batch.Set("batch_a", "a", 0)
+	batch.Set("batch_b", "b", 0)
+	batch.SetBytes("batch_c", []byte("c"), 0)
+	batch.Del("batch_missing")
+	batch.Del("batch_missing")
+
+	if err := batch.Flush(); err != nil {
+		t.Error("batch writer flush returned an error")
+	}
+
+	for key, value := range map[string]string { "batch_a": "a", "batch_b": "b", "batch_c": "c" } {
+		response, _ := pool.GetBytes(key)
+
+		if string(response) != value {
+			t.Errorf("get returned %q for %q instead of %q after a flush", response, key, value)
+		}
+	}
+
+	lock.Lock()
+
+	if len(errs) != 1 || errs["batch_missing"] != PaperErrorKeyNotFound {
+		t.Errorf("batch writer reported %v instead of only the missing key", errs)
+	}
+
+	lock.Unlock()
+
+	batch.Del("batch_a")
+	batch.Close()
+
+	if _, err := pool.GetBytes("batch_a"); err != PaperErrorKeyNotFound {
+		t.Error("batch writer close did not write the buffered commands")
+	}
+
+	if err := batch.Set("batch_a", "a", 0); err != PaperErrorBatchWriterClosed {
+		t.Error("closed batch writer did not return PaperErrorBatchWriterClosed")
+	}
+
+	if err := batch.Flush(); err != PaperErrorBatchWriterClosed {
+		t.Error("closed batch writer flush did not return PaperErrorBatchWriterClosed")
+	}
+}
+
+func TestBatchWriterInterval(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 1)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+
+	batch := pool.BatchWriter(BatchWriterConfig {
+		Interval: 10 * time.Millisecond,
+	})
+
+	defer batch.Close()
+
+	batch.Set("batch_interval", "value", 0)
+
+	for i := 0; i < 100; i++ {
+		if response, _ := pool.GetBytes("batch_interval"); string(response) == "value" {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("batch writer did not write buffered commands after the interval")
+}
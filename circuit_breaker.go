@@ -0,0 +1,357 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"sync"
+	"time"
+)
+
+// The state of a CircuitBreaker.
+type CircuitState uint32
+
+const (
+	// Commands are sent, and their outcomes are measured.
+	CircuitClosed CircuitState = iota
+
+	// Commands fail straight away with PaperErrorCircuitOpen.
+	CircuitOpen
+
+	// A limited number of trial commands are sent to check whether the
+	// server has recovered.
+	CircuitHalfOpen
+)
+
+func (state CircuitState) String() string {
+	switch state {
+		case CircuitClosed: return "closed"
+		case CircuitOpen: return "open"
+		case CircuitHalfOpen: return "half-open"
+	}
+
+	return "unknown"
+}
+
+type CircuitBreakerConfig struct {
+	// The number of most recent commands over which the failure rate is
+	// measured.
+	WindowSize uint32
+
+	// The number of commands which must be measured before the circuit
+	// can open.
+	MinRequests uint32
+
+	// Opens the circuit once this fraction (e.g. 0.5) of the measured
+	// commands failed.
+	FailureRate float64
+
+	// Commands which take at least this long count as failures. Zero
+	// disables the latency threshold.
+	SlowThreshold time.Duration
+
+	// How long the circuit stays open before trial commands are sent.
+	OpenTimeout time.Duration
+
+	// The number of trial commands which must succeed while half-open for
+	// the circuit to close again.
+	HalfOpenRequests uint32
+
+	// Called (from the goroutine whose command caused it) whenever the
+	// circuit changes state.
+	OnStateChange func(from CircuitState, to CircuitState)
+}
+
+// A snapshot of a CircuitBreaker's counters.
+type CircuitMetrics struct {
+	State CircuitState
+
+	// Totals since the breaker was created.
+	Requests uint64
+	Failures uint64
+	Rejected uint64
+
+	// The failure rate over the current window of commands.
+	FailureRate float64
+}
+
+// The outcome of a command allowed by a CircuitBreaker.
+type circuitOutcome uint8
+
+const (
+	circuitSuccess circuitOutcome = iota
+	circuitFailure
+
+	// The command neither succeeded nor failed in a way which reflects on
+	// the server, e.g. the caller cancelled it. It is not measured.
+	circuitIgnored
+)
+
+const DefaultCircuitWindowSize uint32 = 20
+const DefaultCircuitMinRequests uint32 = 10
+const DefaultCircuitFailureRate = 0.5
+const DefaultCircuitOpenTimeout = 5 * time.Second
+const DefaultCircuitHalfOpenRequests uint32 = 1
+
+// Stops sending commands to an unhealthy server, so that they fail fast
+// with PaperErrorCircuitOpen instead of waiting on dial timeouts and
+// reconnects. Only failures of the connection (including timeouts) and
+// slow commands count against the server. Errors returned by the server,
+// such as PaperErrorKeyNotFound, do not. A CircuitBreaker is safe for
+// concurrent use and may be shared by several clients and pools.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+	lock sync.Mutex
+
+	state CircuitState
+
+	// Increments on every state change, so that the outcomes of commands
+	// allowed in an earlier state are ignored.
+	generation uint64
+
+	// The outcomes of the most recent commands, true for failures.
+	window []bool
+	window_index int
+	window_count int
+	window_failures int
+
+	opened_at time.Time
+
+	trials uint32
+	trial_successes uint32
+
+	requests uint64
+	failures uint64
+	rejected uint64
+}
+
+// Creates a circuit breaker. Zero fields of the config use the defaults.
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.WindowSize == 0 {
+		config.WindowSize = DefaultCircuitWindowSize
+	}
+
+	if config.MinRequests == 0 {
+		config.MinRequests = DefaultCircuitMinRequests
+	}
+
+	if config.MinRequests > config.WindowSize {
+		config.MinRequests = config.WindowSize
+	}
+
+	if config.FailureRate <= 0 {
+		config.FailureRate = DefaultCircuitFailureRate
+	}
+
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = DefaultCircuitOpenTimeout
+	}
+
+	if config.HalfOpenRequests == 0 {
+		config.HalfOpenRequests = DefaultCircuitHalfOpenRequests
+	}
+
+	return &CircuitBreaker {
+		config: config,
+		window: make([]bool, config.WindowSize),
+	}
+}
+
+// Gets the state of the circuit.
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	return breaker.state
+}
+
+// Gets a snapshot of the breaker's counters.
+func (breaker *CircuitBreaker) Metrics() CircuitMetrics {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	var failure_rate float64
+
+	if breaker.window_count > 0 {
+		failure_rate = float64(breaker.window_failures) / float64(breaker.window_count)
+	}
+
+	return CircuitMetrics {
+		State: breaker.state,
+
+		Requests: breaker.requests,
+		Failures: breaker.failures,
+		Rejected: breaker.rejected,
+
+		FailureRate: failure_rate,
+	}
+}
+
+// Checks if the circuit is open and rejecting commands, without admitting
+// one, so that callers can fail fast before acquiring a connection.
+func (breaker *CircuitBreaker) isOpen() bool {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.state != CircuitOpen || time.Since(breaker.opened_at) >= breaker.config.OpenTimeout {
+		return false
+	}
+
+	breaker.rejected++
+	return true
+}
+
+// Checks if a command may be sent, returning the generation to pass to
+// record once it completes, or PaperErrorCircuitOpen.
+func (breaker *CircuitBreaker) allow() (uint64, error) {
+	breaker.lock.Lock()
+
+	var change func()
+
+	if breaker.state == CircuitOpen && time.Since(breaker.opened_at) >= breaker.config.OpenTimeout {
+		change = breaker.transition(CircuitHalfOpen)
+	}
+
+	err := breaker.admit()
+	generation := breaker.generation
+
+	breaker.lock.Unlock()
+
+	if change != nil {
+		change()
+	}
+
+	return generation, err
+}
+
+func (breaker *CircuitBreaker) admit() error {
+	switch breaker.state {
+		case CircuitOpen:
+			breaker.rejected++
+			return PaperErrorCircuitOpen
+
+		case CircuitHalfOpen:
+			if breaker.trials >= breaker.config.HalfOpenRequests {
+				breaker.rejected++
+				return PaperErrorCircuitOpen
+			}
+
+			breaker.trials++
+	}
+
+	breaker.requests++
+	return nil
+}
+
+// Records the outcome of a command allowed in the supplied generation.
+// An ignored command gives its trial back if the circuit is half-open.
+func (breaker *CircuitBreaker) record(generation uint64, outcome circuitOutcome, duration time.Duration) {
+	breaker.lock.Lock()
+
+	if outcome == circuitIgnored {
+		if generation == breaker.generation && breaker.state == CircuitHalfOpen {
+			breaker.trials--
+		}
+
+		breaker.lock.Unlock()
+		return
+	}
+
+	failed := outcome == circuitFailure
+
+	if threshold := breaker.config.SlowThreshold; threshold > 0 && duration >= threshold {
+		failed = true
+	}
+
+	if failed {
+		breaker.failures++
+	}
+
+	var change func()
+
+	if generation == breaker.generation {
+		change = breaker.measure(failed)
+	}
+
+	breaker.lock.Unlock()
+
+	if change != nil {
+		change()
+	}
+}
+
+func (breaker *CircuitBreaker) measure(failed bool) func() {
+	switch breaker.state {
+		case CircuitHalfOpen:
+			if failed {
+				return breaker.transition(CircuitOpen)
+			}
+
+			breaker.trial_successes++
+
+			if breaker.trial_successes >= breaker.config.HalfOpenRequests {
+				return breaker.transition(CircuitClosed)
+			}
+
+		case CircuitClosed:
+			if breaker.window_count == len(breaker.window) {
+				if breaker.window[breaker.window_index] {
+					breaker.window_failures--
+				}
+			} else {
+				breaker.window_count++
+			}
+
+			breaker.window[breaker.window_index] = failed
+			breaker.window_index = (breaker.window_index + 1) % len(breaker.window)
+
+			if failed {
+				breaker.window_failures++
+			}
+
+			failure_rate := float64(breaker.window_failures) / float64(breaker.window_count)
+
+			if uint32(breaker.window_count) >= breaker.config.MinRequests && failure_rate >= breaker.config.FailureRate {
+				return breaker.transition(CircuitOpen)
+			}
+	}
+
+	return nil
+}
+
+// Changes state while the lock is held, returning a function which calls
+// OnStateChange once the lock is released.
+func (breaker *CircuitBreaker) transition(state CircuitState) func() {
+	from := breaker.state
+
+	breaker.state = state
+	breaker.generation++
+
+	switch state {
+		case CircuitOpen:
+			breaker.opened_at = time.Now()
+
+		case CircuitHalfOpen:
+			breaker.trials = 0
+			breaker.trial_successes = 0
+
+		case CircuitClosed:
+			breaker.window_index = 0
+			breaker.window_count = 0
+			breaker.window_failures = 0
+	}
+
+	on_state_change := breaker.config.OnStateChange
+
+	if on_state_change == nil {
+		return nil
+	}
+
+	return func() {
+		on_state_change(from, state)
+	}
+}
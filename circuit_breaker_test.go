@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"fmt"
+	"net"
+	"errors"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	changes := []string{}
+
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 4,
+		MinRequests: 4,
+		FailureRate: 0.5,
+		OpenTimeout: 20 * time.Millisecond,
+
+		OnStateChange: func(from CircuitState, to CircuitState) {
+			changes = append(changes, fmt.Sprintf("%v->%v", from, to))
+		},
+	})
+
+	for _, outcome := range []circuitOutcome { circuitSuccess, circuitSuccess, circuitFailure, circuitFailure } {
+		generation, err := breaker.allow()
+
+		if err != nil {
+			t.Fatal("closed circuit rejected a command")
+		}
+
+		breaker.record(generation, outcome, 0)
+	}
+
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("circuit was %v instead of open after half of the commands failed", breaker.State())
+	}
+
+	if _, err := breaker.allow(); err != PaperErrorCircuitOpen {
+		t.Error("open circuit did not reject a command")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	generation, err := breaker.allow()
+
+	if err != nil {
+		t.Fatal("circuit did not allow a trial command after the open timeout")
+	}
+
+	if _, err := breaker.allow(); err != PaperErrorCircuitOpen {
+		t.Error("half-open circuit allowed more than one trial command")
+	}
+
+	breaker.record(generation, circuitSuccess, 0)
+
+	if breaker.State() != CircuitClosed {
+		t.Errorf("circuit was %v instead of closed after a successful trial", breaker.State())
+	}
+
+	metrics := breaker.Metrics()
+
+	if metrics.Requests != 5 || metrics.Failures != 2 || metrics.Rejected != 2 {
+		t.Errorf("circuit metrics were %+v", metrics)
+	}
+
+	expected := "closed->open,open->half-open,half-open->closed"
+
+	if strings.Join(changes, ",") != expected {
+		t.Errorf("circuit state changes were %v instead of %s", changes, expected)
+	}
+}
+
+func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 1,
+		OpenTimeout: 10 * time.Millisecond,
+	})
+
+	generation, _ := breaker.allow()
+	breaker.record(generation, circuitFailure, 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	generation, _ = breaker.allow()
+
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("circuit was %v instead of half-open", breaker.State())
+	}
+
+	breaker.record(generation, circuitFailure, 0)
+
+	if breaker.State() != CircuitOpen {
+		t.Errorf("circuit was %v instead of open after a failed trial", breaker.State())
+	}
+}
+
+func TestCircuitBreakerHalfOpenIgnored(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 1,
+		OpenTimeout: 10 * time.Millisecond,
+	})
+
+	generation, _ := breaker.allow()
+	breaker.record(generation, circuitFailure, 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	generation, _ = breaker.allow()
+	breaker.record(generation, circuitIgnored, 0)
+
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("circuit was %v instead of half-open after a cancelled trial", breaker.State())
+	}
+
+	if _, err := breaker.allow(); err != nil {
+		t.Error("circuit did not allow another trial after a cancelled trial")
+	}
+}
+
+func TestCircuitBreakerSlowThreshold(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 1,
+		SlowThreshold: 10 * time.Millisecond,
+	})
+
+	generation, _ := breaker.allow()
+	breaker.record(generation, circuitSuccess, 20 * time.Millisecond)
+
+	if breaker.State() != CircuitOpen {
+		t.Errorf("circuit was %v instead of open after a slow command", breaker.State())
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 2,
+		MinRequests: 2,
+		OpenTimeout: time.Hour,
+	})
+
+	client, err := ClientConnect(
+		initStalledServer(t),
+		WithTimeout(20 * time.Millisecond),
+		WithCircuitBreaker(breaker),
+	)
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	// the connection's ping succeeded, and this one times out
+	client.Ping()
+
+	start := time.Now()
+
+	if _, err := client.Ping(); err != PaperErrorCircuitOpen {
+		t.Errorf("ping returned %v instead of PaperErrorCircuitOpen after the server timed out", err)
+	}
+
+	if time.Since(start) > 10 * time.Millisecond {
+		t.Error("open circuit did not fail fast")
+	}
+}
+
+func TestClientCircuitBreakerServerErrors(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 2,
+	})
+
+	client, err := ClientConnect("paper://127.0.0.1:3145", WithCircuitBreaker(breaker))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	for i := 0; i < 5; i++ {
+		client.Get("circuit_missing_key")
+	}
+
+	if breaker.State() != CircuitClosed {
+		t.Errorf("circuit was %v instead of closed after the server returned errors", breaker.State())
+	}
+}
+
+func TestClientCircuitBreakerCancelledTrial(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 1,
+		OpenTimeout: 10 * time.Millisecond,
+	})
+
+	client, err := ClientConnect(initStalledServer(t), WithCircuitBreaker(breaker))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	generation, _ := breaker.allow()
+	breaker.record(generation, circuitFailure, 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(10 * time.Millisecond, cancel)
+	client.PingContext(ctx)
+
+	if breaker.State() != CircuitHalfOpen {
+		t.Errorf("circuit was %v instead of half-open after a cancelled trial", breaker.State())
+	}
+}
+
+func TestDialCircuitBreaker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal("could not reserve an address")
+	}
+
+	addr := "paper://" + listener.Addr().String()
+	listener.Close()
+
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 1,
+		OpenTimeout: time.Hour,
+	})
+
+	ClientConnect(addr, WithCircuitBreaker(breaker))
+
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("circuit was %v instead of open after a failed dial", breaker.State())
+	}
+
+	if _, err := ClientConnect(addr, WithCircuitBreaker(breaker)); err != PaperErrorCircuitOpen {
+		t.Errorf("connecting returned %v instead of PaperErrorCircuitOpen", err)
+	}
+}
+
+func TestPoolCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig {
+		WindowSize: 1,
+		OpenTimeout: time.Hour,
+	})
+
+	pool, err := PoolConnect("paper://127.0.0.1:3145", 2, WithCircuitBreaker(breaker))
+
+	if err != nil {
+		t.Fatal("could not connect pool")
+	}
+
+	defer pool.Close()
+
+	generation, _ := breaker.allow()
+	breaker.record(generation, circuitFailure, 0)
+
+	if _, err := pool.Ping(); !errors.Is(err, PaperErrorCircuitOpen) {
+		t.Errorf("pool ping returned %v instead of PaperErrorCircuitOpen", err)
+	}
+
+	if open := len(pool.slots); open != 1 {
+		t.Errorf("pool opened a connection while the circuit was open")
+	}
+}
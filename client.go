@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"io"
+	"context"
+)
+
+// The commands shared by PaperClient and PaperPool, so that callers (and
+// wrappers such as caching layers or middleware) can depend on either.
+type Client interface {
+	Ping() (string, error)
+	PingContext(ctx context.Context) (string, error)
+
+	Version() (string, error)
+	VersionContext(ctx context.Context) (string, error)
+
+	Auth(token string) error
+	AuthContext(ctx context.Context, token string) error
+
+	Get(key string) (string, error)
+	GetContext(ctx context.Context, key string) (string, error)
+
+	GetBytes(key string) ([]byte, error)
+	GetBytesContext(ctx context.Context, key string) ([]byte, error)
+
+	GetInto(key string, dst []byte) ([]byte, error)
+	GetIntoContext(ctx context.Context, key string, dst []byte) ([]byte, error)
+
+	GetTo(key string, w io.Writer) (int64, error)
+	GetToContext(ctx context.Context, key string, w io.Writer) (int64, error)
+
+	Set(key string, value string, ttl uint32) error
+	SetContext(ctx context.Context, key string, value string, ttl uint32) error
+
+	SetBytes(key string, value []byte, ttl uint32) error
+	SetBytesContext(ctx context.Context, key string, value []byte, ttl uint32) error
+
+	SetFrom(key string, r io.Reader, size uint32, ttl uint32) error
+	SetFromContext(ctx context.Context, key string, r io.Reader, size uint32, ttl uint32) error
+
+	Del(key string) error
+	DelContext(ctx context.Context, key string) error
+
+	Has(key string) (bool, error)
+	HasContext(ctx context.Context, key string) (bool, error)
+
+	Peek(key string) (string, error)
+	PeekContext(ctx context.Context, key string) (string, error)
+
+	PeekBytes(key string) ([]byte, error)
+	PeekBytesContext(ctx context.Context, key string) ([]byte, error)
+
+	Ttl(key string, ttl uint32) error
+	TtlContext(ctx context.Context, key string, ttl uint32) error
+
+	Size(key string) (uint32, error)
+	SizeContext(ctx context.Context, key string) (uint32, error)
+
+	Wipe() error
+	WipeContext(ctx context.Context) error
+
+	Resize(size uint64) error
+	ResizeContext(ctx context.Context, size uint64) error
+
+	Policy(policy string) error
+	PolicyContext(ctx context.Context, policy string) error
+
+	Status() (*PaperStatus, error)
+	StatusContext(ctx context.Context) (*PaperStatus, error)
+
+	MGet(keys []string) (map[string]string, map[string]error)
+	MGetContext(ctx context.Context, keys []string) (map[string]string, map[string]error)
+
+	MSet(entries map[string]string, ttl uint32) map[string]error
+	MSetContext(ctx context.Context, entries map[string]string, ttl uint32) map[string]error
+
+	MDel(keys []string) map[string]error
+	MDelContext(ctx context.Context, keys []string) map[string]error
+
+	MHas(keys []string) (map[string]bool, map[string]error)
+	MHasContext(ctx context.Context, keys []string) (map[string]bool, map[string]error)
+
+	Pipeline() *Pipeline
+
+	Disconnect()
+	Close()
+}
+
+var _ Client = (*PaperClient)(nil)
+var _ Client = (*PaperPool)(nil)
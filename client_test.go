@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"testing"
+)
+
+func TestClientInterface(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	clients := map[string]Client {
+		"client": initClient(t, false),
+		"pool": pool,
+	}
+
+	for name, client := range clients {
+		if err := client.Auth("auth_token"); err != nil {
+			t.Errorf("%s auth returned an error", name)
+		}
+
+		if err := client.Set("interface_key", name, 0); err != nil {
+			t.Errorf("%s set returned an error", name)
+		}
+
+		if response, err := client.Get("interface_key"); err != nil || response != name {
+			t.Errorf("%s get returned %q instead of %q", name, response, name)
+		}
+	}
+
+	if err := pool.Auth("invalid_token"); err != PaperErrorUnauthorized {
+		t.Errorf("pool auth returned %v instead of PaperErrorUnauthorized", err)
+	}
+
+	clients["client"].Disconnect()
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+// The requests for each command, shared by PaperClient and Pipeline.
+
+func pingWriter() *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(pingByte)
+
+	return writer
+}
+
+func versionWriter() *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(versionByte)
+
+	return writer
+}
+
+func authWriter(token string) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(authByte)
+	writer.writeString(token)
+
+	return writer
+}
+
+func getWriter(key string) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(getByte)
+	writer.writeString(key)
+
+	return writer
+}
+
+func setWriter(key string, value string, ttl uint32) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(setByte)
+	writer.writeString(key)
+	writer.writeString(value)
+	writer.writeU32(ttl)
+
+	return writer
+}
+
+func setBytesWriter(key string, value []byte, ttl uint32) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(setByte)
+	writer.writeString(key)
+	writer.writeBytes(value)
+	writer.writeU32(ttl)
+
+	return writer
+}
+
+func delWriter(key string) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(delByte)
+	writer.writeString(key)
+
+	return writer
+}
+
+func hasWriter(key string) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(hasByte)
+	writer.writeString(key)
+
+	return writer
+}
+
+func peekWriter(key string) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(peekByte)
+	writer.writeString(key)
+
+	return writer
+}
+
+func ttlWriter(key string, ttl uint32) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(ttlByte)
+	writer.writeString(key)
+	writer.writeU32(ttl)
+
+	return writer
+}
+
+func sizeWriter(key string) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(sizeByte)
+	writer.writeString(key)
+
+	return writer
+}
+
+func wipeWriter() *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(wipeByte)
+
+	return writer
+}
+
+func resizeWriter(size uint64) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(resizeByte)
+	writer.writeU64(size)
+
+	return writer
+}
+
+func policyWriter(policy string) *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(policyByte)
+	writer.writeString(policy)
+
+	return writer
+}
+
+func statusWriter() *sheetWriter {
+	writer := initSheetWriter()
+	writer.writeU8(statusByte)
+
+	return writer
+}
@@ -0,0 +1,494 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"net"
+	"time"
+	"context"
+	"math/rand"
+	"crypto/tls"
+)
+
+const (
+	DefaultMaxReconnects uint32 = 8
+	DefaultPoolSize uint32 = 4
+	DefaultPoolMinSize uint32 = 1
+	DefaultPoolHealthCheckFailures uint32 = 2
+
+	DefaultMaxResponseSize uint64 = 512 * 1024 * 1024
+	DefaultMaxValueSize uint32 = 256 * 1024 * 1024
+	DefaultMaxPolicies uint32 = 256
+
+	DefaultBackoffInitial = 10 * time.Millisecond
+	DefaultBackoffMax = 2 * time.Second
+	DefaultBackoffJitter = 0.2
+)
+
+// Dials the server at the supplied address. The network is "tcp" or, for
+// paper+unix:// addresses, "unix". The returned connection can
+// be any transport which carries the PaperCache protocol (a TCP socket,
+// an SSH channel, one end of a net.Pipe, etc.).
+type DialFunc func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// Gets the delay before the supplied reconnect attempt, starting at 1.
+type BackoffFunc func(attempt uint32) time.Duration
+
+// Receives the client's log messages. A *log.Logger satisfies this.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Functions called as the client runs, e.g. to record metrics. Any of
+// them may be nil.
+type Hooks struct {
+	// Called after each command with its name (e.g. "get"), how long it
+	// took, and the error it returned, if any.
+	OnCommand func(command string, duration time.Duration, err error)
+
+	// Called when a connection becomes ready, with the server's address.
+	// This includes the initial connection and every reconnect. For a
+	// pool, it is called when the first of its connections becomes ready.
+	OnConnect func(host string)
+
+	// Called when a ready connection is lost, with the error which broke
+	// it, or nil if it was closed by Disconnect or Close. For a pool, it is
+	// called when it no longer has any ready connections, and not when it
+	// closes idle, expired or failed connections itself.
+	OnDisconnect func(err error)
+
+	// Called after each reconnect attempt with its number (starting at 1
+	// for each reconnect) and the error if it failed.
+	OnReconnect func(attempt uint32, err error)
+
+	// Called when the server rejects the client's auth token.
+	OnAuthFailure func(err error)
+}
+
+// Configures how a PaperClient (or each client in a PaperPool) connects
+// to the server.
+type Config struct {
+	// If set, each connection is authorized with this token as soon as it
+	// is established.
+	AuthToken string
+
+	// Bounds dialing and each command whose context has no deadline of its
+	// own. Zero means no timeout.
+	Timeout time.Duration
+
+	// Bounds dialing (including the TLS handshake) in place of Timeout.
+	DialTimeout time.Duration
+
+	// Bounds reading each response and writing each request respectively.
+	// These apply on top of the context's deadline and Timeout.
+	ReadTimeout time.Duration
+	WriteTimeout time.Duration
+
+	// The number of attempts a command makes to reconnect a broken
+	// connection before failing with PaperErrorMaxConnectionsExceeded.
+	// Each command which finds the connection broken starts again. Zero
+	// uses DefaultMaxReconnects when passed to ClientConnectWithConfig or
+	// PoolConnectWithConfig; set max_reconnects=0 in the address instead
+	// to never reconnect.
+	MaxReconnects uint32
+
+	// Gets the delay before each reconnect attempt. If nil, reconnects
+	// are attempted immediately.
+	Backoff BackoffFunc
+
+	// If set, a broken connection is reconnected by a background goroutine
+	// which keeps trying (ignoring MaxReconnects) until it succeeds or the
+	// client is closed. Meanwhile, commands fail straight away with
+	// PaperErrorUnreachableServer rather than reconnecting themselves.
+	BackgroundReconnect bool
+
+	// Decides whether commands are retried after transient network errors.
+	// If nil, they are never retried.
+	RetryPolicy RetryPolicy
+
+	// If set, commands fail fast with PaperErrorCircuitOpen while the
+	// breaker considers the server unhealthy. Every client of a pool
+	// shares it.
+	CircuitBreaker *CircuitBreaker
+
+	// The maximum number of connections opened by PoolConnect when it is
+	// called with a size of zero. Zero uses DefaultPoolSize.
+	PoolSize uint32
+
+	// The number of connections a pool opens up front and keeps open even
+	// when they are idle.
+	PoolMinSize uint32
+
+	// Closes pooled connections which have been idle for this long, down
+	// to PoolMinSize. Zero keeps idle connections open.
+	PoolIdleTimeout time.Duration
+
+	// Closes pooled connections once they have been open for this long
+	// (when they are next idle), so that load is rebalanced behind a load
+	// balancer. Zero keeps connections open indefinitely.
+	PoolMaxLifetime time.Duration
+
+	// How often idle pooled connections are pinged. Zero disables health
+	// checks.
+	PoolHealthCheckInterval time.Duration
+
+	// The number of consecutive failed health checks after which a pooled
+	// connection is closed and replaced.
+	PoolHealthCheckFailures uint32
+
+	// Bounds how long acquiring a pooled client waits for one to become
+	// idle, returning PaperErrorPoolTimeout. Zero means acquiring waits
+	// until its context is done.
+	PoolTimeout time.Duration
+
+	// Used to open every connection, including when reconnecting. If nil,
+	// a plain TCP connection is dialed.
+	Dialer DialFunc
+
+	// The keepalive period of connections opened by the default dialer.
+	// Zero uses the operating system's default and a negative value
+	// disables keepalive.
+	KeepAlive time.Duration
+
+	// The sizes of the socket's receive and send buffers in bytes. Zero
+	// leaves the operating system's default in place.
+	ReadBufferSize int
+	WriteBufferSize int
+
+	// Limits on what the server may send, protecting against corrupt or
+	// hostile length prefixes. A response exceeding any of them fails with
+	// PaperErrorResponseTooLarge and its connection is closed. Zero means
+	// no limit.
+	//
+	// MaxResponseSize bounds the total size of a response in bytes,
+	// MaxValueSize bounds each value (or other string) in bytes, and
+	// MaxPolicies bounds the number of policies in a status.
+	MaxResponseSize uint64
+	MaxValueSize uint32
+	MaxPolicies uint32
+
+	// Used for paper+tls:// addresses. Root CAs, client certificates for
+	// mutual TLS, the server name, etc. are all set here. If nil, the
+	// system roots are used and the server name is taken from the address.
+	TLSConfig *tls.Config
+
+	// SHA-256 hashes of the DER-encoded SubjectPublicKeyInfo of accepted
+	// server certificates. If any are set, the server's chain must contain
+	// at least one matching certificate.
+	CertificatePins [][]byte
+
+	// Receives messages about reconnects and failures. If nil, nothing is
+	// logged.
+	Logger Logger
+
+	Hooks Hooks
+}
+
+// Modifies the Config used to connect to the server.
+type Option func(*Config)
+
+// Gets the configuration used when no options are supplied.
+func DefaultConfig() Config {
+	return Config {
+		MaxReconnects: DefaultMaxReconnects,
+		Backoff: JitterBackoff(
+			ExponentialBackoff(DefaultBackoffInitial, DefaultBackoffMax),
+			DefaultBackoffJitter,
+		),
+
+		RetryPolicy: &IdempotentRetryPolicy {
+			MaxRetries: DefaultMaxRetries,
+		},
+
+		PoolSize: DefaultPoolSize,
+		PoolMinSize: DefaultPoolMinSize,
+		PoolHealthCheckFailures: DefaultPoolHealthCheckFailures,
+
+		MaxResponseSize: DefaultMaxResponseSize,
+		MaxValueSize: DefaultMaxValueSize,
+		MaxPolicies: DefaultMaxPolicies,
+	}
+}
+
+// Gets a backoff which always waits for the supplied delay.
+func ConstantBackoff(delay time.Duration) BackoffFunc {
+	return func(attempt uint32) time.Duration {
+		return delay
+	}
+}
+
+// Gets a backoff which waits for the initial delay before the first
+// attempt and doubles it for each consecutive attempt, up to max.
+func ExponentialBackoff(initial time.Duration, max time.Duration) BackoffFunc {
+	return func(attempt uint32) time.Duration {
+		delay := initial
+
+		for i := uint32(1); i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+
+		if delay > max {
+			return max
+		}
+
+		return delay
+	}
+}
+
+// Randomizes the delays of the supplied backoff by up to the supplied
+// fraction (e.g. 0.2 for 20%) in either direction, so that clients which
+// lost their connections at the same time do not reconnect in lockstep.
+func JitterBackoff(backoff BackoffFunc, fraction float64) BackoffFunc {
+	return func(attempt uint32) time.Duration {
+		delay := float64(backoff(attempt))
+		return time.Duration(delay + delay * fraction * (2 * rand.Float64() - 1))
+	}
+}
+
+// Authorizes each connection with the supplied token when it is
+// established.
+func WithAuthToken(token string) Option {
+	return func(config *Config) {
+		config.AuthToken = token
+	}
+}
+
+// Bounds dialing and each command whose context has no deadline of its
+// own by the supplied timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.Timeout = timeout
+	}
+}
+
+// Bounds dialing by the supplied timeout.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.DialTimeout = timeout
+	}
+}
+
+// Bounds reading each response by the supplied timeout.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.ReadTimeout = timeout
+	}
+}
+
+// Bounds writing each request by the supplied timeout.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.WriteTimeout = timeout
+	}
+}
+
+// Sets the number of attempts a command makes to reconnect a broken
+// connection.
+func WithMaxReconnects(max_reconnects uint32) Option {
+	return func(config *Config) {
+		config.MaxReconnects = max_reconnects
+	}
+}
+
+// Waits for the delay given by the supplied function before each
+// reconnect attempt.
+func WithBackoff(backoff BackoffFunc) Option {
+	return func(config *Config) {
+		config.Backoff = backoff
+	}
+}
+
+// Reconnects broken connections in the background instead of within the
+// commands which find them broken.
+func WithBackgroundReconnect() Option {
+	return func(config *Config) {
+		config.BackgroundReconnect = true
+	}
+}
+
+// Decides whether commands are retried after transient network errors
+// with the supplied policy, or never retries them if it is nil.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(config *Config) {
+		config.RetryPolicy = policy
+	}
+}
+
+// Sends commands through the supplied circuit breaker.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(config *Config) {
+		config.CircuitBreaker = breaker
+	}
+}
+
+// Sets the maximum number of connections opened by PoolConnect when it is
+// called with a size of zero.
+func WithPoolSize(pool_size uint32) Option {
+	return func(config *Config) {
+		config.PoolSize = pool_size
+	}
+}
+
+// Sets the number of connections a pool keeps open even when idle.
+func WithPoolMinSize(min_size uint32) Option {
+	return func(config *Config) {
+		config.PoolMinSize = min_size
+	}
+}
+
+// Sets how long a pooled connection may be idle before it is closed.
+func WithPoolIdleTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.PoolIdleTimeout = timeout
+	}
+}
+
+// Sets how long a pooled connection may be open before it is recycled.
+func WithPoolMaxLifetime(lifetime time.Duration) Option {
+	return func(config *Config) {
+		config.PoolMaxLifetime = lifetime
+	}
+}
+
+// Pings idle pooled connections at the supplied interval, replacing those
+// which fail the supplied number of consecutive checks.
+func WithPoolHealthCheck(interval time.Duration, failures uint32) Option {
+	return func(config *Config) {
+		config.PoolHealthCheckInterval = interval
+		config.PoolHealthCheckFailures = failures
+	}
+}
+
+// Sets how long acquiring a pooled client waits for one to become idle.
+func WithPoolTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.PoolTimeout = timeout
+	}
+}
+
+// Dials every connection with the supplied function.
+func WithDialer(dialer DialFunc) Option {
+	return func(config *Config) {
+		config.Dialer = dialer
+	}
+}
+
+// Dials every connection with the supplied net.Dialer, which allows the
+// local address, keepalive period, socket options, etc. to be set.
+func WithNetDialer(dialer *net.Dialer) Option {
+	return func(config *Config) {
+		config.Dialer = dialer.DialContext
+	}
+}
+
+// Sets the keepalive period of connections opened by the default dialer.
+func WithKeepAlive(keep_alive time.Duration) Option {
+	return func(config *Config) {
+		config.KeepAlive = keep_alive
+	}
+}
+
+// Sets the sizes of each connection's receive and send buffers.
+func WithBufferSizes(read_buffer_size int, write_buffer_size int) Option {
+	return func(config *Config) {
+		config.ReadBufferSize = read_buffer_size
+		config.WriteBufferSize = write_buffer_size
+	}
+}
+
+// Sets the limits on the total size of a response, the size of each value
+// in it, and the number of policies in a status. Zero means no limit.
+func WithResponseLimits(max_response_size uint64, max_value_size uint32, max_policies uint32) Option {
+	return func(config *Config) {
+		config.MaxResponseSize = max_response_size
+		config.MaxValueSize = max_value_size
+		config.MaxPolicies = max_policies
+	}
+}
+
+// Configures TLS for paper+tls:// addresses.
+func WithTLSConfig(tls_config *tls.Config) Option {
+	return func(config *Config) {
+		config.TLSConfig = tls_config
+	}
+}
+
+// Pins the server's certificate to one of the supplied SHA-256 hashes of
+// a SubjectPublicKeyInfo (see CertificatePin).
+func WithCertificatePins(pins ...[]byte) Option {
+	return func(config *Config) {
+		config.CertificatePins = append(config.CertificatePins, pins...)
+	}
+}
+
+// Sends the client's log messages to the supplied logger.
+func WithLogger(logger Logger) Option {
+	return func(config *Config) {
+		config.Logger = logger
+	}
+}
+
+// Calls the supplied hooks as the client runs.
+func WithHooks(hooks Hooks) Option {
+	return func(config *Config) {
+		config.Hooks = hooks
+	}
+}
+
+// Parses the address on top of the supplied configuration and then applies
+// the supplied options, so that options take precedence over the address.
+// Fills in the defaults of fields which a Config built by the caller rather
+// than from DefaultConfig may leave zero, where zero would leave a client
+// unable to reconnect or a pool without any connections.
+func (config *Config) applyDefaults() {
+	if config.MaxReconnects == 0 {
+		config.MaxReconnects = DefaultMaxReconnects
+	}
+
+	if config.PoolSize == 0 {
+		config.PoolSize = DefaultPoolSize
+	}
+}
+
+func initConfig(paper_addr string, config Config, opts []Option) (*paperAddr, *Config, error) {
+	addr, err := parsePaperAddr(paper_addr, &config)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return addr, &config, nil
+}
+
+// Bounds the context by the supplied timeout if it has no deadline of its
+// own.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, has_deadline := ctx.Deadline(); has_deadline || timeout == 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (config *Config) dialTimeout() time.Duration {
+	if config.DialTimeout != 0 {
+		return config.DialTimeout
+	}
+
+	return config.Timeout
+}
+
+func (config *Config) logf(format string, args ...interface{}) {
+	if config.Logger != nil {
+		config.Logger.Printf("paperclient: " + format, args...)
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"os"
+	"log"
+	"net"
+	"time"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"context"
+)
+
+func TestDialer(t *testing.T) {
+	dials := 0
+
+	dialer := func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		dials += 1
+
+		client_conn, server_conn := net.Pipe()
+		go serveStalled(server_conn)
+
+		return client_conn, nil
+	}
+
+	client, err := ClientConnect("paper://pipe", WithDialer(dialer))
+
+	if err != nil {
+		t.Fatal("could not connect client over a pipe")
+	}
+
+	defer client.Disconnect()
+
+	if dials != 1 {
+		t.Errorf("dialer was called %d times instead of once", dials)
+	}
+
+	client.Disconnect()
+	response, err := client.Ping()
+
+	if err != nil {
+		t.Error("ping returned an error after redialing")
+	}
+
+	if response != "pong" {
+		t.Error("ping did not return pong after redialing")
+	}
+
+	if dials != 2 {
+		t.Error("dialer was not used to reconnect")
+	}
+}
+
+func TestNetDialer(t *testing.T) {
+	dialer := &net.Dialer {
+		KeepAlive: 30 * time.Second,
+	}
+
+	client, err := ClientConnect("paper://127.0.0.1:3145", WithNetDialer(dialer))
+
+	if err != nil {
+		t.Fatal("could not connect client with a net dialer")
+	}
+
+	defer client.Disconnect()
+
+	response, err := client.Ping()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if response != "pong" {
+		t.Error("ping did not return pong")
+	}
+}
+
+func TestClientConnectWithConfig(t *testing.T) {
+	var commands []string
+
+	config := DefaultConfig()
+	config.AuthToken = "auth_token"
+	config.Hooks.OnCommand = func(command string, duration time.Duration, err error) {
+		commands = append(commands, command)
+	}
+
+	client, err := ClientConnectWithConfig("paper://127.0.0.1:3145", config)
+
+	if err != nil {
+		t.Fatal("could not connect client with a config")
+	}
+
+	defer client.Disconnect()
+
+	if err := client.Set("key", "value", 0); err != nil {
+		t.Error("client with an auth token in its config was not authorized")
+	}
+
+	if strings.Join(commands, ",") != "ping,auth,set" {
+		t.Errorf("command hook observed %v", commands)
+	}
+}
+
+func TestConnectWithZeroConfig(t *testing.T) {
+	client, err := ClientConnectWithConfig("paper://127.0.0.1:3145", Config { Timeout: time.Second })
+
+	if err != nil {
+		t.Fatal("could not connect client with a zero config")
+	}
+
+	defer client.Disconnect()
+
+	if client.config.MaxReconnects != DefaultMaxReconnects {
+		t.Errorf("zero config used %d max reconnects instead of the default", client.config.MaxReconnects)
+	}
+
+	client, err = ClientConnectWithConfig("paper://127.0.0.1:3145?max_reconnects=0", Config {})
+
+	if err != nil {
+		t.Fatal("could not connect client with a zero config")
+	}
+
+	defer client.Disconnect()
+
+	if client.config.MaxReconnects != 0 {
+		t.Error("max_reconnects=0 in the address did not override the default")
+	}
+
+	pool, err := PoolConnectWithConfig("paper://127.0.0.1:3145", Config {})
+
+	if err != nil {
+		t.Fatal("could not connect pool with a zero config")
+	}
+
+	defer pool.Disconnect()
+
+	if pool.size != DefaultPoolSize {
+		t.Errorf("zero config pool had %d connections instead of the default", pool.size)
+	}
+}
+
+func TestPoolConnectWithConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.AuthToken = "auth_token"
+	config.PoolSize = 2
+	config.PoolMinSize = 2
+
+	pool, err := PoolConnectWithConfig("paper://127.0.0.1:3145", config)
+
+	if err != nil {
+		t.Fatal("could not connect pool with a config")
+	}
+
+	defer pool.Disconnect()
+
+	if len(pool.clients()) != 2 {
+		t.Errorf("pool opened %d connections instead of 2", len(pool.clients()))
+	}
+
+	lockable_client := pool.LockableClient()
+	client := lockable_client.Lock()
+
+	if err := client.Set("key", "value", 0); err != nil {
+		t.Error("pool client with an auth token in its config was not authorized")
+	}
+
+	lockable_client.Unlock()
+}
+
+func TestReadTimeout(t *testing.T) {
+	client, err := ClientConnect(initStalledServer(t), WithReadTimeout(100 * time.Millisecond))
+
+	if err != nil {
+		t.Fatal("could not connect client with a read timeout")
+	}
+
+	defer client.Disconnect()
+
+	_, err = client.Get("key")
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("get on a stalled server did not time out")
+	}
+}
+
+func TestBackoffAndLogger(t *testing.T) {
+	var logs bytes.Buffer
+
+	client, err := ClientConnect(
+		"paper://127.0.0.1:3145",
+		WithBackoff(ConstantBackoff(50 * time.Millisecond)),
+		WithLogger(log.New(&logs, "", 0)),
+	)
+
+	if err != nil {
+		t.Fatal("could not connect client with a backoff")
+	}
+
+	defer client.Disconnect()
+
+	client.Disconnect()
+
+	start := time.Now()
+	_, err = client.Ping()
+
+	if err != nil {
+		t.Error("ping returned an error after reconnecting")
+	}
+
+	if time.Since(start) < 50 * time.Millisecond {
+		t.Error("reconnect did not wait for the backoff")
+	}
+
+	if !strings.Contains(logs.String(), "reconnecting to 127.0.0.1:3145") {
+		t.Errorf("reconnect was not logged: %q", logs.String())
+	}
+}
@@ -14,6 +14,13 @@ var PaperErrorInternal = errors.New("PaperError: internal")
 var PaperErrorUnreachableServer = errors.New("PaperError: unreachable server")
 var PaperErrorMaxConnectionsExceeded = errors.New("PaperError: max connections exceeded")
 var PaperErrorUnauthorized = errors.New("PaperError: unauthorized")
+var PaperErrorCertificatePinMismatch = errors.New("PaperError: certificate pin mismatch")
+
+var PaperErrorClosed = errors.New("PaperError: closed")
+var PaperErrorCircuitOpen = errors.New("PaperError: circuit open")
+var PaperErrorResponseTooLarge = errors.New("PaperError: response too large")
+var PaperErrorPoolTimeout = errors.New("PaperError: pool timeout")
+var PaperErrorBatchWriterClosed = errors.New("PaperError: batch writer closed")
 
 var PaperErrorKeyNotFound = errors.New("PaperError: key not found")
 
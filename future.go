@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"context"
+)
+
+// The eventual result of an asynchronous command. Commands which only
+// return an error resolve to a Future[struct{}].
+type Future[T any] struct {
+	done chan struct{}
+	value T
+	err error
+}
+
+// Anything which can be waited on by WaitAll and WaitAny. Every Future
+// implements it, whatever its value type.
+type Awaitable interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+func runAsync[T any](ctx context.Context, pool *PaperPool, command func(context.Context, *PaperClient) (T, error)) *Future[T] {
+	future := &Future[T] {
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(future.done)
+
+		future.err = pool.Do(ctx, func(client *PaperClient) error {
+			var err error
+			future.value, err = command(ctx, client)
+
+			return err
+		})
+	}()
+
+	return future
+}
+
+func runAsyncErr(ctx context.Context, pool *PaperPool, command func(context.Context, *PaperClient) error) *Future[struct{}] {
+	return runAsync(ctx, pool, func(ctx context.Context, client *PaperClient) (struct{}, error) {
+		return struct{}{}, command(ctx, client)
+	})
+}
+
+// Returns a channel which is closed once the future has resolved.
+func (future *Future[T]) Done() <-chan struct{} {
+	return future.done
+}
+
+// Blocks until the future has resolved and returns its value and error.
+func (future *Future[T]) Wait() (T, error) {
+	<-future.done
+	return future.value, future.err
+}
+
+// Blocks until the future has resolved or the supplied context is done,
+// in which case the context's error is returned. The command itself keeps
+// running until its own context is done.
+func (future *Future[T]) WaitContext(ctx context.Context) (T, error) {
+	select {
+		case <-future.done:
+			return future.value, future.err
+
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+	}
+}
+
+// Blocks until the future has resolved and returns its error.
+func (future *Future[T]) Err() error {
+	<-future.done
+	return future.err
+}
+
+// Waits for every supplied future to resolve, returning the first error
+// in the order the futures were supplied, or the context's error if it is
+// done first.
+func WaitAll(ctx context.Context, futures ...Awaitable) error {
+	for _, future := range futures {
+		select {
+			case <-future.Done():
+			case <-ctx.Done():
+				return ctx.Err()
+		}
+	}
+
+	for _, future := range futures {
+		if err := future.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Waits for any of the supplied futures to resolve, returning its index
+// and error, or -1 and the context's error if it is done first.
+func WaitAny(ctx context.Context, futures ...Awaitable) (int, error) {
+	done := make(chan int, len(futures))
+	stop := make(chan struct{})
+	defer close(stop)
+
+	for i, future := range futures {
+		go func(i int, future Awaitable) {
+			select {
+				case <-future.Done():
+					done <- i
+				case <-stop:
+			}
+		}(i, future)
+	}
+
+	select {
+		case i := <-done:
+			return i, futures[i].Err()
+
+		case <-ctx.Done():
+			return -1, ctx.Err()
+	}
+}
+
+// Pings the server asynchronously using one of the pool's clients.
+func (pool *PaperPool) PingAsync() *Future[string] {
+	return pool.PingAsyncContext(context.Background())
+}
+
+// Pings the server asynchronously within the supplied context.
+func (pool *PaperPool) PingAsyncContext(ctx context.Context) *Future[string] {
+	return runAsync(ctx, pool, func(ctx context.Context, client *PaperClient) (string, error) {
+		return client.PingContext(ctx)
+	})
+}
+
+// Gets the value of the supplied key asynchronously using one of the
+// pool's clients.
+func (pool *PaperPool) GetAsync(key string) *Future[string] {
+	return pool.GetAsyncContext(context.Background(), key)
+}
+
+// Gets the value of the supplied key asynchronously within the supplied
+// context.
+func (pool *PaperPool) GetAsyncContext(ctx context.Context, key string) *Future[string] {
+	return runAsync(ctx, pool, func(ctx context.Context, client *PaperClient) (string, error) {
+		return client.GetContext(ctx, key)
+	})
+}
+
+// Gets the value of the supplied key as bytes asynchronously using one of
+// the pool's clients.
+func (pool *PaperPool) GetBytesAsync(key string) *Future[[]byte] {
+	return pool.GetBytesAsyncContext(context.Background(), key)
+}
+
+// Gets the value of the supplied key as bytes asynchronously within the
+// supplied context.
+func (pool *PaperPool) GetBytesAsyncContext(ctx context.Context, key string) *Future[[]byte] {
+	return runAsync(ctx, pool, func(ctx context.Context, client *PaperClient) ([]byte, error) {
+		return client.GetBytesContext(ctx, key)
+	})
+}
+
+// Sets the supplied key, value, and TTL asynchronously using one of the
+// pool's clients.
+func (pool *PaperPool) SetAsync(key string, value string, ttl uint32) *Future[struct{}] {
+	return pool.SetAsyncContext(context.Background(), key, value, ttl)
+}
+
+// Sets the supplied key, value, and TTL asynchronously within the supplied
+// context.
+func (pool *PaperPool) SetAsyncContext(ctx context.Context, key string, value string, ttl uint32) *Future[struct{}] {
+	return runAsyncErr(ctx, pool, func(ctx context.Context, client *PaperClient) error {
+		return client.SetContext(ctx, key, value, ttl)
+	})
+}
+
+// Sets the supplied key, value as bytes, and TTL asynchronously using one
+// of the pool's clients.
+func (pool *PaperPool) SetBytesAsync(key string, value []byte, ttl uint32) *Future[struct{}] {
+	return pool.SetBytesAsyncContext(context.Background(), key, value, ttl)
+}
+
+// Sets the supplied key, value as bytes, and TTL asynchronously within the
+// supplied context.
+func (pool *PaperPool) SetBytesAsyncContext(ctx context.Context, key string, value []byte, ttl uint32) *Future[struct{}] {
+	return runAsyncErr(ctx, pool, func(ctx context.Context, client *PaperClient) error {
+		return client.SetBytesContext(ctx, key, value, ttl)
+	})
+}
+
+// Deletes the value of the supplied key asynchronously using one of the
+// pool's clients.
+func (pool *PaperPool) DelAsync(key string) *Future[struct{}] {
+	return pool.DelAsyncContext(context.Background(), key)
+}
+
+// Deletes the value of the supplied key asynchronously within the supplied
+// context.
+func (pool *PaperPool) DelAsyncContext(ctx context.Context, key string) *Future[struct{}] {
+	return runAsyncErr(ctx, pool, func(ctx context.Context, client *PaperClient) error {
+		return client.DelContext(ctx, key)
+	})
+}
+
+// Checks if the cache contains the supplied key asynchronously using one
+// of the pool's clients.
+func (pool *PaperPool) HasAsync(key string) *Future[bool] {
+	return pool.HasAsyncContext(context.Background(), key)
+}
+
+// Checks if the cache contains the supplied key asynchronously within the
+// supplied context.
+func (pool *PaperPool) HasAsyncContext(ctx context.Context, key string) *Future[bool] {
+	return runAsync(ctx, pool, func(ctx context.Context, client *PaperClient) (bool, error) {
+		return client.HasContext(ctx, key)
+	})
+}
+
+// Peeks the value of the supplied key asynchronously using one of the
+// pool's clients.
+func (pool *PaperPool) PeekAsync(key string) *Future[string] {
+	return pool.PeekAsyncContext(context.Background(), key)
+}
+
+// Peeks the value of the supplied key asynchronously within the supplied
+// context.
+func (pool *PaperPool) PeekAsyncContext(ctx context.Context, key string) *Future[string] {
+	return runAsync(ctx, pool, func(ctx context.Context, client *PaperClient) (string, error) {
+		return client.PeekContext(ctx, key)
+	})
+}
+
+// Sets the TTL of the supplied key asynchronously using one of the pool's
+// clients.
+func (pool *PaperPool) TtlAsync(key string, ttl uint32) *Future[struct{}] {
+	return pool.TtlAsyncContext(context.Background(), key, ttl)
+}
+
+// Sets the TTL of the supplied key asynchronously within the supplied
+// context.
+func (pool *PaperPool) TtlAsyncContext(ctx context.Context, key string, ttl uint32) *Future[struct{}] {
+	return runAsyncErr(ctx, pool, func(ctx context.Context, client *PaperClient) error {
+		return client.TtlContext(ctx, key, ttl)
+	})
+}
+
+// Gets the size of the value of the supplied key asynchronously using one
+// of the pool's clients.
+func (pool *PaperPool) SizeAsync(key string) *Future[uint32] {
+	return pool.SizeAsyncContext(context.Background(), key)
+}
+
+// Gets the size of the value of the supplied key asynchronously within the
+// supplied context.
+func (pool *PaperPool) SizeAsyncContext(ctx context.Context, key string) *Future[uint32] {
+	return runAsync(ctx, pool, func(ctx context.Context, client *PaperClient) (uint32, error) {
+		return client.SizeContext(ctx, key)
+	})
+}
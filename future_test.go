@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAsync(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+
+	if err := pool.SetAsync("async_key", "value", 0).Err(); err != nil {
+		t.Error("async set returned an error")
+	}
+
+	get := pool.GetAsync("async_key")
+	has := pool.HasAsync("async_key")
+	missing := pool.GetAsync("async_missing_key")
+
+	pool.DelAsync("async_missing_key").Wait()
+
+	if err := WaitAll(context.Background(), get, has); err != nil {
+		t.Error("wait all returned an error")
+	}
+
+	if value, _ := get.Wait(); value != "value" {
+		t.Errorf("async get returned %q instead of \"value\"", value)
+	}
+
+	if value, _ := has.Wait(); !value {
+		t.Error("async has returned false for a key which exists")
+	}
+
+	if _, err := missing.Wait(); err == nil {
+		t.Error("async get did not return an error for a key which does not exist")
+	}
+}
+
+func TestWaitAny(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	index, err := WaitAny(context.Background(), pool.PingAsync(), pool.PingAsync())
+
+	if err != nil || index < 0 || index > 1 {
+		t.Errorf("wait any returned %d, %v", index, err)
+	}
+}
+
+func TestAsyncContextDeadline(t *testing.T) {
+	pool, err := PoolConnect(initStalledServer(t), 1)
+
+	if err != nil {
+		t.Fatal("could not connect pool")
+	}
+
+	defer pool.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	future := pool.PingAsyncContext(ctx)
+
+	if err := WaitAll(context.Background(), future); err != context.DeadlineExceeded {
+		t.Errorf("async ping returned %v instead of context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitContextDeadline(t *testing.T) {
+	pool, err := PoolConnect(initStalledServer(t), 1)
+
+	if err != nil {
+		t.Fatal("could not connect pool")
+	}
+
+	defer pool.Disconnect()
+
+	cmd_ctx, cmd_cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cmd_cancel()
+
+	future := pool.PingAsyncContext(cmd_ctx)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+
+	if _, err := future.WaitContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wait context returned %v instead of context.DeadlineExceeded", err)
+	}
+
+	if _, err := WaitAny(ctx, future); err != context.DeadlineExceeded {
+		t.Errorf("wait any returned %v instead of context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"sync"
+	"time"
+	"errors"
+	"context"
+	"sync/atomic"
+)
+
+type HedgeConfig struct {
+	// How long a read may take before it is sent again.
+	Delay time.Duration
+
+	// The maximum number of hedged reads as a fraction of all reads (e.g.
+	// 0.1 for at most 10% extra load). Zero uses DefaultHedgeBudget.
+	Budget float64
+
+	// Where hedged reads are sent, in turn. If empty, they are sent to the
+	// primary again, which for a pool means another of its connections.
+	// Replicas are not disconnected along with the HedgedClient.
+	Replicas []Client
+}
+
+const DefaultHedgeBudget = 0.1
+
+// The most hedged reads which can be saved up by reads which were not
+// hedged, bounding bursts of extra load.
+const hedgeMaxTokens = 10
+
+// Wraps a client (usually a pool) to hedge its idempotent reads: if a Get,
+// GetBytes, Peek, PeekBytes, Has or Size has not been answered within the
+// configured delay, or it fails to reach the server, the same read is
+// sent to a replica (or another of the pool's connections) and the first
+// response wins, cancelling the other. A pool replaces the connection of a
+// cancelled read. Every other command is passed to the primary client
+// unchanged.
+type HedgedClient struct {
+	Client
+
+	config HedgeConfig
+
+	tokens float64
+	tokens_lock sync.Mutex
+
+	replica_index uint32
+}
+
+type hedgeResult[T any] struct {
+	value T
+	err error
+}
+
+var _ Client = (*HedgedClient)(nil)
+
+// Creates a client which hedges the primary client's reads. A single
+// PaperClient runs one command at a time, so hedging its reads onto itself
+// would only queue them, and it must be given replicas.
+func NewHedgedClient(primary Client, config HedgeConfig) (*HedgedClient, error) {
+	if _, ok := primary.(*PaperClient); ok && len(config.Replicas) == 0 {
+		return nil, errors.New("Hedging a single client requires replicas.")
+	}
+
+	if config.Budget <= 0 {
+		config.Budget = DefaultHedgeBudget
+	}
+
+	return &HedgedClient {
+		Client: primary,
+		config: config,
+	}, nil
+}
+
+// Gets the value of the supplied key, hedging the read.
+func (hedged *HedgedClient) Get(key string) (string, error) {
+	return hedged.GetContext(context.Background(), key)
+}
+
+// Gets the value of the supplied key within the supplied context, hedging
+// the read.
+func (hedged *HedgedClient) GetContext(ctx context.Context, key string) (string, error) {
+	return hedge(ctx, hedged, func(ctx context.Context, client Client) (string, error) {
+		return client.GetContext(ctx, key)
+	})
+}
+
+// Gets the value of the supplied key as bytes, hedging the read.
+func (hedged *HedgedClient) GetBytes(key string) ([]byte, error) {
+	return hedged.GetBytesContext(context.Background(), key)
+}
+
+// Gets the value of the supplied key as bytes within the supplied context,
+// hedging the read.
+func (hedged *HedgedClient) GetBytesContext(ctx context.Context, key string) ([]byte, error) {
+	return hedge(ctx, hedged, func(ctx context.Context, client Client) ([]byte, error) {
+		return client.GetBytesContext(ctx, key)
+	})
+}
+
+// Peeks the value of the supplied key, hedging the read.
+func (hedged *HedgedClient) Peek(key string) (string, error) {
+	return hedged.PeekContext(context.Background(), key)
+}
+
+// Peeks the value of the supplied key within the supplied context, hedging
+// the read.
+func (hedged *HedgedClient) PeekContext(ctx context.Context, key string) (string, error) {
+	return hedge(ctx, hedged, func(ctx context.Context, client Client) (string, error) {
+		return client.PeekContext(ctx, key)
+	})
+}
+
+// Peeks the value of the supplied key as bytes, hedging the read.
+func (hedged *HedgedClient) PeekBytes(key string) ([]byte, error) {
+	return hedged.PeekBytesContext(context.Background(), key)
+}
+
+// Peeks the value of the supplied key as bytes within the supplied
+// context, hedging the read.
+func (hedged *HedgedClient) PeekBytesContext(ctx context.Context, key string) ([]byte, error) {
+	return hedge(ctx, hedged, func(ctx context.Context, client Client) ([]byte, error) {
+		return client.PeekBytesContext(ctx, key)
+	})
+}
+
+// Checks if the cache contains the supplied key, hedging the read.
+func (hedged *HedgedClient) Has(key string) (bool, error) {
+	return hedged.HasContext(context.Background(), key)
+}
+
+// Checks if the cache contains the supplied key within the supplied
+// context, hedging the read.
+func (hedged *HedgedClient) HasContext(ctx context.Context, key string) (bool, error) {
+	return hedge(ctx, hedged, func(ctx context.Context, client Client) (bool, error) {
+		return client.HasContext(ctx, key)
+	})
+}
+
+// Gets the size of the value of the supplied key, hedging the read.
+func (hedged *HedgedClient) Size(key string) (uint32, error) {
+	return hedged.SizeContext(context.Background(), key)
+}
+
+// Gets the size of the value of the supplied key within the supplied
+// context, hedging the read.
+func (hedged *HedgedClient) SizeContext(ctx context.Context, key string) (uint32, error) {
+	return hedge(ctx, hedged, func(ctx context.Context, client Client) (uint32, error) {
+		return client.SizeContext(ctx, key)
+	})
+}
+
+// Sends the read to the primary client and, if it is slow or fails to
+// reach the server, to a replica too, returning the first response. The
+// other read is cancelled once this returns.
+func hedge[T any](ctx context.Context, hedged *HedgedClient, read func(context.Context, Client) (T, error)) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult[T], 2)
+
+	send := func(client Client) {
+		go func() {
+			value, err := read(ctx, client)
+			results <- hedgeResult[T] { value, err }
+		}()
+	}
+
+	send(hedged.Client)
+	hedged.earn()
+
+	timer := time.NewTimer(hedged.config.Delay)
+	defer timer.Stop()
+
+	pending := 1
+	can_hedge := true
+
+	for {
+		select {
+			case result := <-results:
+				pending--
+
+				if isResponse(result.err) {
+					return result.value, result.err
+				}
+
+				if can_hedge && ctx.Err() == nil && hedged.spend() {
+					// the read could not reach the server, so there is no
+					// point in waiting for the delay
+					can_hedge = false
+					pending++
+
+					send(hedged.replica())
+					continue
+				}
+
+				if pending == 0 {
+					return result.value, result.err
+				}
+
+			case <-timer.C:
+				if can_hedge && hedged.spend() {
+					pending++
+					send(hedged.replica())
+				}
+
+				can_hedge = false
+
+			case <-ctx.Done():
+				var zero T
+				return zero, ctx.Err()
+		}
+	}
+}
+
+// Checks if the error came from the server answering the read, as opposed
+// to the read failing to reach it.
+func isResponse(err error) bool {
+	switch err {
+		case nil,
+			PaperErrorKeyNotFound,
+			PaperErrorUnauthorized,
+			PaperErrorInternal:
+
+			return true
+	}
+
+	return false
+}
+
+// Gets the client which the next hedged read is sent to.
+func (hedged *HedgedClient) replica() Client {
+	replicas := hedged.config.Replicas
+
+	if len(replicas) == 0 {
+		return hedged.Client
+	}
+
+	index := atomic.AddUint32(&hedged.replica_index, 1) - 1
+	return replicas[index % uint32(len(replicas))]
+}
+
+// Saves up the budget for hedging a fraction of a read.
+func (hedged *HedgedClient) earn() {
+	hedged.tokens_lock.Lock()
+	defer hedged.tokens_lock.Unlock()
+
+	hedged.tokens += hedged.config.Budget
+
+	if hedged.tokens > hedgeMaxTokens {
+		hedged.tokens = hedgeMaxTokens
+	}
+}
+
+// Spends the budget for hedging one read, if it has been saved up.
+func (hedged *HedgedClient) spend() bool {
+	hedged.tokens_lock.Lock()
+	defer hedged.tokens_lock.Unlock()
+
+	if hedged.tokens < 1 {
+		return false
+	}
+
+	hedged.tokens--
+	return true
+}
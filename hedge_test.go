@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHedgedRead(t *testing.T) {
+	replica := initClient(t, true)
+	defer replica.Close()
+
+	replica.Set("hedge_key", "value", 0)
+
+	primary := initStalledClient(t)
+	defer primary.Close()
+
+	hedged, _ := NewHedgedClient(primary, HedgeConfig {
+		Delay: 20 * time.Millisecond,
+		Budget: 1,
+		Replicas: []Client { replica },
+	})
+
+	start := time.Now()
+	value, err := hedged.Get("hedge_key")
+
+	if err != nil || value != "value" {
+		t.Errorf("hedged get returned %q, %v instead of the replica's value", value, err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Error("hedged get waited for the slow primary")
+	}
+}
+
+func TestHedgedReadFastPrimary(t *testing.T) {
+	primary := initClient(t, true)
+	defer primary.Close()
+
+	primary.Del("hedge_missing_key")
+
+	replica := initStalledClient(t)
+	defer replica.Close()
+
+	hedged, _ := NewHedgedClient(primary, HedgeConfig {
+		Delay: time.Second,
+		Budget: 1,
+		Replicas: []Client { replica },
+	})
+
+	if _, err := hedged.Get("hedge_missing_key"); err != PaperErrorKeyNotFound {
+		t.Errorf("hedged get returned %v instead of the primary's PaperErrorKeyNotFound", err)
+	}
+}
+
+func TestHedgedReadBudget(t *testing.T) {
+	replica := initClient(t, true)
+	defer replica.Close()
+
+	replica.Set("hedge_key", "value", 0)
+
+	primary, err := ClientConnect(initStalledServer(t), WithTimeout(100 * time.Millisecond))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer primary.Close()
+
+	hedged, _ := NewHedgedClient(primary, HedgeConfig {
+		Delay: 10 * time.Millisecond,
+		Budget: 0.01,
+		Replicas: []Client { replica },
+	})
+
+	if _, err := hedged.Get("hedge_key"); err == nil {
+		t.Error("hedged get was sent to the replica without any budget")
+	}
+}
+
+func TestHedgedReadCancelsLoser(t *testing.T) {
+	replica := initClient(t, true)
+	defer replica.Close()
+
+	replica.Set("hedge_key", "value", 0)
+
+	primary, err := PoolConnect(initStalledServer(t), 2)
+
+	if err != nil {
+		t.Fatal("could not connect pool")
+	}
+
+	defer primary.Close()
+
+	hedged, _ := NewHedgedClient(primary, HedgeConfig {
+		Delay: 10 * time.Millisecond,
+		Budget: 1,
+		Replicas: []Client { replica },
+	})
+
+	for i := 0; i < 5; i++ {
+		if value, err := hedged.Get("hedge_key"); err != nil || value != "value" {
+			t.Fatalf("hedged get returned %q, %v instead of the replica's value", value, err)
+		}
+	}
+
+	for i := 0; i < 100 && len(primary.idle) != len(primary.slots); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(primary.idle) != len(primary.slots) {
+		t.Error("cancelled hedged reads kept the primary's connections checked out")
+	}
+}
+
+func TestHedgedClientRequiresReplicas(t *testing.T) {
+	client := initClient(t, false)
+	defer client.Close()
+
+	if _, err := NewHedgedClient(client, HedgeConfig {}); err == nil {
+		t.Error("hedging a single client without replicas did not return an error")
+	}
+
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Close()
+
+	if _, err := NewHedgedClient(pool, HedgeConfig {}); err != nil {
+		t.Error("hedging a pool without replicas returned an error")
+	}
+}
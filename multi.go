@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"sync"
+	"context"
+)
+
+// The number of keys a pool's multi-key command sends over each
+// connection before it opens another, up to the pool's size.
+const multiChunkKeys = 16
+
+// Gets the values of the supplied keys in a single pipeline. Found values
+// are returned in the first map, and keys which failed are returned in the
+// second with their error (PaperErrorKeyNotFound for keys which do not
+// exist, or the transport error if the connection failed).
+func (client *PaperClient) MGet(keys []string) (map[string]string, map[string]error) {
+	return client.MGetContext(context.Background(), keys)
+}
+
+// Gets the values of the supplied keys in a single pipeline within the
+// supplied context.
+func (client *PaperClient) MGetContext(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+	return mget(keys, client.execMulti(ctx, keys, queueGet))
+}
+
+// Sets the supplied entries with the supplied TTL in a single pipeline,
+// returning the error of each entry which could not be set.
+func (client *PaperClient) MSet(entries map[string]string, ttl uint32) map[string]error {
+	return client.MSetContext(context.Background(), entries, ttl)
+}
+
+// Sets the supplied entries with the supplied TTL in a single pipeline
+// within the supplied context.
+func (client *PaperClient) MSetContext(ctx context.Context, entries map[string]string, ttl uint32) map[string]error {
+	keys := entryKeys(entries)
+	return merrors(keys, client.execMulti(ctx, keys, queueSet(entries, ttl)))
+}
+
+// Deletes the supplied keys in a single pipeline, returning the error of
+// each key which could not be deleted.
+func (client *PaperClient) MDel(keys []string) map[string]error {
+	return client.MDelContext(context.Background(), keys)
+}
+
+// Deletes the supplied keys in a single pipeline within the supplied
+// context.
+func (client *PaperClient) MDelContext(ctx context.Context, keys []string) map[string]error {
+	return merrors(keys, client.execMulti(ctx, keys, queueDel))
+}
+
+// Checks if the cache contains each of the supplied keys in a single
+// pipeline, returning the error of each key which could not be checked.
+func (client *PaperClient) MHas(keys []string) (map[string]bool, map[string]error) {
+	return client.MHasContext(context.Background(), keys)
+}
+
+// Checks if the cache contains each of the supplied keys in a single
+// pipeline within the supplied context.
+func (client *PaperClient) MHasContext(ctx context.Context, keys []string) (map[string]bool, map[string]error) {
+	return mhas(keys, client.execMulti(ctx, keys, queueHas))
+}
+
+// Gets the values of the supplied keys, spreading them across the pool's
+// clients. Results are reported as in PaperClient.MGet.
+func (pool *PaperPool) MGet(keys []string) (map[string]string, map[string]error) {
+	return pool.MGetContext(context.Background(), keys)
+}
+
+// Gets the values of the supplied keys, spreading them across the pool's
+// clients within the supplied context.
+func (pool *PaperPool) MGetContext(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+	return mget(keys, pool.execMulti(ctx, keys, queueGet))
+}
+
+// Sets the supplied entries with the supplied TTL, spreading them across
+// the pool's clients.
+func (pool *PaperPool) MSet(entries map[string]string, ttl uint32) map[string]error {
+	return pool.MSetContext(context.Background(), entries, ttl)
+}
+
+// Sets the supplied entries with the supplied TTL, spreading them across
+// the pool's clients within the supplied context.
+func (pool *PaperPool) MSetContext(ctx context.Context, entries map[string]string, ttl uint32) map[string]error {
+	keys := entryKeys(entries)
+	return merrors(keys, pool.execMulti(ctx, keys, queueSet(entries, ttl)))
+}
+
+// Deletes the supplied keys, spreading them across the pool's clients.
+func (pool *PaperPool) MDel(keys []string) map[string]error {
+	return pool.MDelContext(context.Background(), keys)
+}
+
+// Deletes the supplied keys, spreading them across the pool's clients
+// within the supplied context.
+func (pool *PaperPool) MDelContext(ctx context.Context, keys []string) map[string]error {
+	return merrors(keys, pool.execMulti(ctx, keys, queueDel))
+}
+
+// Checks if the cache contains each of the supplied keys, spreading them
+// across the pool's clients.
+func (pool *PaperPool) MHas(keys []string) (map[string]bool, map[string]error) {
+	return pool.MHasContext(context.Background(), keys)
+}
+
+// Checks if the cache contains each of the supplied keys, spreading them
+// across the pool's clients within the supplied context.
+func (pool *PaperPool) MHasContext(ctx context.Context, keys []string) (map[string]bool, map[string]error) {
+	return mhas(keys, pool.execMulti(ctx, keys, queueHas))
+}
+
+func (client *PaperClient) execMulti(ctx context.Context, keys []string, queue func(*Pipeline, string)) []PipelineResult {
+	pipeline := client.Pipeline()
+
+	for _, key := range keys {
+		queue(pipeline, key)
+	}
+
+	return pipeline.ExecContext(ctx)
+}
+
+// Splits the keys into contiguous chunks and pipelines each chunk
+// concurrently on its own connection, returning the results in the order
+// of the keys.
+func (pool *PaperPool) execMulti(ctx context.Context, keys []string, queue func(*Pipeline, string)) []PipelineResult {
+	results := make([]PipelineResult, len(keys))
+	num_chunks := pool.multiChunks(len(keys))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < num_chunks; i++ {
+		start := i * len(keys) / num_chunks
+		end := (i + 1) * len(keys) / num_chunks
+
+		wg.Add(1)
+
+		go func(start int, end int) {
+			defer wg.Done()
+
+			pipeline := pool.Pipeline()
+
+			for _, key := range keys[start:end] {
+				queue(pipeline, key)
+			}
+
+			copy(results[start:end], pipeline.ExecContext(ctx))
+		}(start, end)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// Gets the number of chunks the supplied number of keys are split into:
+// one for each connection the pool has open, or, if it is more, one for
+// each multiChunkKeys keys up to the pool's size, so that only large
+// batches grow the pool.
+func (pool *PaperPool) multiChunks(num_keys int) int {
+	num_chunks := (num_keys + multiChunkKeys - 1) / multiChunkKeys
+
+	if num_chunks > int(pool.size) {
+		num_chunks = int(pool.size)
+	}
+
+	if open := len(pool.slots); open > num_chunks {
+		num_chunks = open
+	}
+
+	if num_chunks > num_keys {
+		num_chunks = num_keys
+	}
+
+	return num_chunks
+}
+
+func queueGet(pipeline *Pipeline, key string) {
+	pipeline.Get(key)
+}
+
+func queueDel(pipeline *Pipeline, key string) {
+	pipeline.Del(key)
+}
+
+func queueHas(pipeline *Pipeline, key string) {
+	pipeline.Has(key)
+}
+
+func queueSet(entries map[string]string, ttl uint32) func(*Pipeline, string) {
+	return func(pipeline *Pipeline, key string) {
+		pipeline.Set(key, entries[key], ttl)
+	}
+}
+
+func entryKeys(entries map[string]string) []string {
+	keys := make([]string, 0, len(entries))
+
+	for key := range entries {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func mget(keys []string, results []PipelineResult) (map[string]string, map[string]error) {
+	values := make(map[string]string, len(keys))
+	errs := make(map[string]error)
+
+	for i, result := range results {
+		if result.Err != nil {
+			errs[keys[i]] = result.Err
+			continue
+		}
+
+		values[keys[i]] = result.Value.(string)
+	}
+
+	return values, errs
+}
+
+func mhas(keys []string, results []PipelineResult) (map[string]bool, map[string]error) {
+	values := make(map[string]bool, len(keys))
+	errs := make(map[string]error)
+
+	for i, result := range results {
+		if result.Err != nil {
+			errs[keys[i]] = result.Err
+			continue
+		}
+
+		values[keys[i]] = result.Value.(bool)
+	}
+
+	return values, errs
+}
+
+func merrors(keys []string, results []PipelineResult) map[string]error {
+	errs := make(map[string]error)
+
+	for i, result := range results {
+		if result.Err != nil {
+			errs[keys[i]] = result.Err
+		}
+	}
+
+	return errs
+}
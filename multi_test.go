@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMulti(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	testMulti(t, client)
+}
+
+func TestPoolMulti(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+
+	testMulti(t, pool)
+}
+
+func TestPoolMultiDoesNotGrow(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 8)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+	pool.MGet([]string { "multi_a", "multi_b", "multi_c", "multi_d" })
+
+	if open := len(pool.slots); open != 1 {
+		t.Errorf("pool opened %d connections for a single mget instead of 1", open)
+	}
+}
+
+func TestPoolMultiChunks(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 8)
+	defer pool.Disconnect()
+
+	chunks := map[int]int {
+		1: 1,
+		16: 1,
+		17: 2,
+		64: 4,
+		1000: 8,
+	}
+
+	for num_keys, expected := range chunks {
+		if num_chunks := pool.multiChunks(num_keys); num_chunks != expected {
+			t.Errorf("%d keys were split into %d chunks instead of %d", num_keys, num_chunks, expected)
+		}
+	}
+}
+
+func TestMultiContextDeadline(t *testing.T) {
+	client := initStalledClient(t)
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	values, errs := client.MGetContext(ctx, []string { "a", "b" })
+
+	if len(values) != 0 {
+		t.Error("mget returned values from a stalled server")
+	}
+
+	for _, key := range []string { "a", "b" } {
+		if errs[key] != context.DeadlineExceeded {
+			t.Errorf("mget returned %v for %q instead of context.DeadlineExceeded", errs[key], key)
+		}
+	}
+}
+
+func testMulti(t *testing.T, client Client) {
+	entries := map[string]string {
+		"multi_a": "a",
+		"multi_b": "b",
+		"multi_c": "c",
+	}
+
+	if errs := client.MSet(entries, 0); len(errs) != 0 {
+		t.Errorf("mset returned errors: %v", errs)
+	}
+
+	client.MDel([]string { "multi_missing" })
+
+	values, errs := client.MGet([]string { "multi_a", "multi_b", "multi_c", "multi_missing" })
+
+	for key, value := range entries {
+		if values[key] != value {
+			t.Errorf("mget returned %q for %q instead of %q", values[key], key, value)
+		}
+	}
+
+	if len(errs) != 1 || errs["multi_missing"] != PaperErrorKeyNotFound {
+		t.Errorf("mget did not report only the missing key as not found: %v", errs)
+	}
+
+	if errs := client.MDel([]string { "multi_a", "multi_missing" }); errs["multi_missing"] != PaperErrorKeyNotFound || len(errs) != 1 {
+		t.Errorf("mdel did not report only the missing key as not found: %v", errs)
+	}
+
+	has, errs := client.MHas([]string { "multi_a", "multi_b" })
+
+	if len(errs) != 0 {
+		t.Errorf("mhas returned errors: %v", errs)
+	}
+
+	if has["multi_a"] || !has["multi_b"] {
+		t.Errorf("mhas returned %v after deleting multi_a", has)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"fmt"
+	"net"
+	"time"
+	"strconv"
+	"net/url"
+)
+
+const defaultPort = "3145"
+
+type paperAddr struct {
+	network string
+	host string
+	tls bool
+}
+
+// Parses a PaperCache address of the form
+//
+//	paper://[:token@]host[:port][?option=value&...]
+//
+// using the paper+tls:// (or papers://) scheme for TLS and paper+unix://
+// followed by a socket path for Unix sockets. The token and any options
+// are written to the supplied config.
+func parsePaperAddr(paper_addr string, config *Config) (*paperAddr, error) {
+	parsed, err := url.Parse(paper_addr)
+
+	if err != nil {
+		return nil, invalidAddr("malformed url")
+	}
+
+	var addr paperAddr
+
+	switch parsed.Scheme {
+		case "paper":
+			addr = paperAddr { "tcp", parsed.Host, false }
+
+		case "paper+tls", "papers":
+			addr = paperAddr { "tcp", parsed.Host, true }
+
+		case "paper+unix":
+			addr = paperAddr { "unix", parsed.Path, false }
+
+		default:
+			return nil, invalidAddr(fmt.Sprintf("unsupported scheme %q", parsed.Scheme))
+	}
+
+	if addr.network == "unix" {
+		if parsed.Host != "" || addr.host == "" {
+			return nil, invalidAddr("expected paper+unix:///path/to/socket")
+		}
+	} else {
+		if parsed.Hostname() == "" {
+			return nil, invalidAddr("missing host")
+		}
+
+		if parsed.Path != "" && parsed.Path != "/" {
+			return nil, invalidAddr("unexpected path")
+		}
+
+		port := parsed.Port()
+
+		if port == "" {
+			port = defaultPort
+		} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return nil, invalidAddr(fmt.Sprintf("invalid port %q", port))
+		}
+
+		addr.host = net.JoinHostPort(parsed.Hostname(), port)
+	}
+
+	if parsed.User != nil {
+		token, has_password := parsed.User.Password()
+
+		if !has_password {
+			token = parsed.User.Username()
+		}
+
+		config.AuthToken = token
+	}
+
+	query, err := url.ParseQuery(parsed.RawQuery)
+
+	if err != nil {
+		return nil, invalidAddr("malformed query")
+	}
+
+	for key, values := range query {
+		if err := applyAddrOption(&addr, config, key, values[len(values) - 1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &addr, nil
+}
+
+func applyAddrOption(addr *paperAddr, config *Config, key string, value string) error {
+	switch key {
+		case "timeout", "dial_timeout", "read_timeout", "write_timeout",
+			"pool_timeout", "pool_idle_timeout", "pool_max_lifetime",
+			"pool_health_check_interval":
+			timeout, err := time.ParseDuration(value)
+
+			if err != nil || timeout < 0 {
+				return invalidAddrOption(key, value)
+			}
+
+			switch key {
+				case "timeout": config.Timeout = timeout
+				case "dial_timeout": config.DialTimeout = timeout
+				case "read_timeout": config.ReadTimeout = timeout
+				case "write_timeout": config.WriteTimeout = timeout
+				case "pool_timeout": config.PoolTimeout = timeout
+				case "pool_idle_timeout": config.PoolIdleTimeout = timeout
+				case "pool_max_lifetime": config.PoolMaxLifetime = timeout
+				case "pool_health_check_interval": config.PoolHealthCheckInterval = timeout
+			}
+
+		case "pool_size":
+			pool_size, err := strconv.ParseUint(value, 10, 32)
+
+			if err != nil || pool_size == 0 {
+				return invalidAddrOption(key, value)
+			}
+
+			config.PoolSize = uint32(pool_size)
+
+		case "pool_min_size":
+			min_size, err := strconv.ParseUint(value, 10, 32)
+
+			if err != nil {
+				return invalidAddrOption(key, value)
+			}
+
+			config.PoolMinSize = uint32(min_size)
+
+		case "max_reconnects":
+			max_reconnects, err := strconv.ParseUint(value, 10, 32)
+
+			if err != nil {
+				return invalidAddrOption(key, value)
+			}
+
+			config.MaxReconnects = uint32(max_reconnects)
+
+		case "tls":
+			use_tls, err := strconv.ParseBool(value)
+
+			if err != nil || (use_tls && addr.network == "unix") {
+				return invalidAddrOption(key, value)
+			}
+
+			// the paper+tls:// and papers:// schemes always use tls, so
+			// that a query can not downgrade them to plaintext
+			if !use_tls && addr.tls {
+				return invalidAddrOption(key, value)
+			}
+
+			addr.tls = use_tls
+
+		default:
+			return invalidAddr(fmt.Sprintf("unknown option %q", key))
+	}
+
+	return nil
+}
+
+func invalidAddr(reason string) error {
+	return fmt.Errorf("Invalid paper address: %s.", reason)
+}
+
+func invalidAddrOption(key string, value string) error {
+	return invalidAddr(fmt.Sprintf("invalid value %q for option %q", value, key))
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"time"
+	"testing"
+)
+
+func TestParseAddr(t *testing.T) {
+	config := DefaultConfig()
+	addr, err := parsePaperAddr("paper://127.0.0.1:3145", &config)
+
+	if err != nil {
+		t.Fatal("parsing a plain address returned an error")
+	}
+
+	if addr.network != "tcp" || addr.host != "127.0.0.1:3145" || addr.tls {
+		t.Errorf("plain address was parsed as %+v", *addr)
+	}
+}
+
+func TestParseAddrDefaultPort(t *testing.T) {
+	config := DefaultConfig()
+	addr, err := parsePaperAddr("paper://cache.internal", &config)
+
+	if err != nil {
+		t.Fatal("parsing an address without a port returned an error")
+	}
+
+	if addr.host != "cache.internal:3145" {
+		t.Errorf("address without a port was parsed as %q", addr.host)
+	}
+}
+
+func TestParseAddrIPv6(t *testing.T) {
+	config := DefaultConfig()
+	addr, err := parsePaperAddr("paper://[::1]:3145", &config)
+
+	if err != nil {
+		t.Fatal("parsing an ipv6 address returned an error")
+	}
+
+	if addr.host != "[::1]:3145" {
+		t.Errorf("ipv6 address was parsed as %q", addr.host)
+	}
+}
+
+func TestParseAddrUnix(t *testing.T) {
+	config := DefaultConfig()
+	addr, err := parsePaperAddr("paper+unix:///run/paper.sock?timeout=1s", &config)
+
+	if err != nil {
+		t.Fatal("parsing a unix address returned an error")
+	}
+
+	if addr.network != "unix" || addr.host != "/run/paper.sock" {
+		t.Errorf("unix address was parsed as %+v", *addr)
+	}
+}
+
+func TestParseAddrOptions(t *testing.T) {
+	config := DefaultConfig()
+	addr, err := parsePaperAddr(
+		"paper://:token@127.0.0.1:3145?timeout=2s&read_timeout=1s&pool_size=8&max_reconnects=5&tls=true",
+		&config,
+	)
+
+	if err != nil {
+		t.Fatal("parsing an address with options returned an error")
+	}
+
+	if !addr.tls {
+		t.Error("tls option was not applied")
+	}
+
+	if config.AuthToken != "token" {
+		t.Errorf("auth token was parsed as %q", config.AuthToken)
+	}
+
+	if config.Timeout != 2 * time.Second {
+		t.Errorf("timeout was parsed as %s", config.Timeout)
+	}
+
+	if config.ReadTimeout != time.Second {
+		t.Errorf("read timeout was parsed as %s", config.ReadTimeout)
+	}
+
+	if config.PoolSize != 8 {
+		t.Errorf("pool size was parsed as %d", config.PoolSize)
+	}
+
+	if config.MaxReconnects != 5 {
+		t.Errorf("max reconnects was parsed as %d", config.MaxReconnects)
+	}
+}
+
+func TestParseAddrInvalid(t *testing.T) {
+	invalid := []string {
+		"127.0.0.1:3145",
+		"http://127.0.0.1:3145",
+		"paper://",
+		"paper://127.0.0.1:port",
+		"paper://127.0.0.1:99999",
+		"paper://127.0.0.1:3145/path",
+		"paper://127.0.0.1:3145?timeout=soon",
+		"paper://127.0.0.1:3145?pool_size=0",
+		"paper://127.0.0.1:3145?unknown=1",
+		"papers://127.0.0.1:3145?tls=false",
+		"paper+tls://127.0.0.1:3145?tls=false",
+		"paper+unix://",
+		"paper+unix://host/run/paper.sock",
+	}
+
+	for _, paper_addr := range invalid {
+		config := DefaultConfig()
+
+		if _, err := parsePaperAddr(paper_addr, &config); err == nil {
+			t.Errorf("parsing %q did not return an error", paper_addr)
+		}
+	}
+}
+
+func TestConnectAuthToken(t *testing.T) {
+	client, err := ClientConnect("paper://:auth_token@127.0.0.1:3145")
+
+	if err != nil {
+		t.Fatal("could not connect client with an auth token")
+	}
+
+	defer client.Disconnect()
+
+	if err := client.Set("key", "value", 0); err != nil {
+		t.Error("client with an auth token in its address was not authorized")
+	}
+
+	_, err = ClientConnect("paper://:incorrect_auth_token@127.0.0.1:3145")
+
+	if err != PaperErrorUnauthorized {
+		t.Error("connecting with an incorrect auth token did not return correct error")
+	}
+}
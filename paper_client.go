@@ -8,8 +8,13 @@
 package paperclient
 
 import (
+	"io"
+	"net"
+	"sync"
+	"time"
 	"errors"
-	"strings"
+	"context"
+	"sync/atomic"
 )
 
 const (
@@ -35,354 +40,989 @@ const (
 	statusByte uint8 = 13
 )
 
-const maxReconnectAttempts = 3
+var commandNames = map[uint8]string {
+	pingByte: "ping",
+	versionByte: "version",
 
+	authByte: "auth",
+
+	getByte: "get",
+	setByte: "set",
+	delByte: "del",
+
+	hasByte: "has",
+	peekByte: "peek",
+	ttlByte: "ttl",
+	sizeByte: "size",
+
+	wipeByte: "wipe",
+
+	resizeByte: "resize",
+	policyByte: "policy",
+
+	statusByte: "status",
+}
+
+// A client connected to a PaperCache server over a single connection.
+// A PaperClient is safe for concurrent use by multiple goroutines: its
+// commands are serialized, each one waiting (within its context) for the
+// previous one to complete.
 type PaperClient struct {
-	addr string
+	addr paperAddr
+	config *Config
+
+	// Holds a value while a goroutine is using the connection. Every field
+	// below is only accessed while it does.
+	lock chan struct{}
 
 	auth_token *string
-	reconnect_attempts uint32
 
+	// Set while a goroutine is reconnecting in the background.
+	reconnecting bool
+
+	// Also guarded by conn_lock when it is replaced, so that Disconnect can
+	// close it without waiting for an in-progress command.
 	tcp_client *tcpClient
+	conn_lock sync.Mutex
+
+	// Closed by Close, after which every command fails.
+	done chan struct{}
+	close_once sync.Once
+
+	// The connection's State, accessed atomically.
+	state uint32
 }
 
 // Connects to PaperCache server at the provided address.
-func ClientConnect(paper_addr string) (*PaperClient, error) {
-	addr_ptr, err := parsePaperAddr(paper_addr)
+func ClientConnect(paper_addr string, opts ...Option) (*PaperClient, error) {
+	return ClientConnectContext(context.Background(), paper_addr, opts...)
+}
+
+// Connects to PaperCache server at the provided address, giving up if
+// the context is done before the connection is established.
+func ClientConnectContext(ctx context.Context, paper_addr string, opts ...Option) (*PaperClient, error) {
+	addr, config, err := initConfig(paper_addr, DefaultConfig(), opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return clientConnect(ctx, *addr, config)
+}
+
+// Connects to PaperCache server at the provided address using the supplied
+// configuration, which should start from DefaultConfig. A zero
+// MaxReconnects uses the default. Any token or options in the address are
+// applied on top of the configuration.
+func ClientConnectWithConfig(paper_addr string, config Config) (*PaperClient, error) {
+	config.applyDefaults()
+
+	addr, config_ptr, err := initConfig(paper_addr, config, nil)
 
 	if err != nil {
 		return nil, err
 	}
 
-	addr := *addr_ptr
-	tcp_client, err := tcpClientConnect(addr)
+	return clientConnect(context.Background(), *addr, config_ptr)
+}
+
+func clientConnect(ctx context.Context, addr paperAddr, config *Config) (*PaperClient, error) {
+	tcp_client, err := dialThroughBreaker(ctx, addr, config)
 
 	if err != nil {
 		return nil, err
 	}
 
 	var auth_token *string = nil
-	var reconnect_attempts uint32 = 0
+
+	lock := make(chan struct{}, 1)
+	done := make(chan struct{})
 
 	client := PaperClient {
-		addr,
+		addr: addr,
+		config: config,
 
-		auth_token,
-		reconnect_attempts,
+		lock: lock,
 
-		tcp_client,
+		auth_token: auth_token,
+
+		tcp_client: tcp_client,
+
+		done: done,
 	}
 
-	_, ping_err := client.Ping()
+	_, ping_err := client.PingContext(ctx)
 
 	if ping_err != nil {
+		client.Disconnect()
+
+		if ctx_err := ctx.Err(); ctx_err != nil {
+			return nil, ctx_err
+		}
+
+		if ping_err == PaperErrorCircuitOpen {
+			return nil, ping_err
+		}
+
 		return nil, errors.New("Connection refused.")
 	}
 
+	client.connected()
+
+	if config.AuthToken != "" {
+		if err := client.AuthContext(ctx, config.AuthToken); err != nil {
+			client.Disconnect()
+			return nil, err
+		}
+	}
+
 	return &client, nil
 }
 
-// Disconnects from the server.
+// Creates a client which is already closed, so that every command fails
+// with PaperErrorClosed.
+func closedClient(addr paperAddr, config *Config) *PaperClient {
+	conn, peer := net.Pipe()
+	peer.Close()
+
+	client := &PaperClient {
+		addr: addr,
+		config: config,
+
+		lock: make(chan struct{}, 1),
+
+		tcp_client: initTcpClient(conn, config),
+
+		done: make(chan struct{}),
+	}
+
+	client.Close()
+
+	return client
+}
+
+// Dials the server unless the configured circuit breaker is open, counting
+// a failed dial against the breaker. A successful dial is not measured,
+// since the ping which follows it is.
+func dialThroughBreaker(ctx context.Context, addr paperAddr, config *Config) (*tcpClient, error) {
+	breaker := config.CircuitBreaker
+
+	if breaker == nil {
+		return tcpClientConnect(ctx, addr, config)
+	}
+
+	generation, err := breaker.allow()
+
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	tcp_client, err := tcpClientConnect(ctx, addr, config)
+
+	outcome := circuitIgnored
+
+	if err != nil && err != context.Canceled {
+		outcome = circuitFailure
+	}
+
+	breaker.record(generation, outcome, time.Since(start))
+
+	return tcp_client, err
+}
+
+// Disconnects from the server. Any in-progress command fails, but the
+// next command reconnects.
 func (client *PaperClient) Disconnect() {
-	client.tcp_client.getConn().Close()
+	client.conn_lock.Lock()
+	client.tcp_client.markBroken()
+	client.conn_lock.Unlock()
+
+	client.lost(nil)
+}
+
+// Disconnects from the server for good. Any in-progress command fails,
+// as does every later one with PaperErrorClosed.
+func (client *PaperClient) Close() {
+	prev := State(atomic.SwapUint32(&client.state, uint32(StateClosed)))
+
+	client.close_once.Do(func() {
+		close(client.done)
+	})
+
+	client.Disconnect()
+
+	if prev == StateReady {
+		client.disconnected(nil)
+	}
 }
 
 // Pings the server.
 func (client *PaperClient) Ping() (string, error) {
-	writer := initSheetWriter()
-	writer.writeU8(pingByte)
+	return client.PingContext(context.Background())
+}
 
-	return client.processData(writer)
+// Pings the server within the supplied context.
+func (client *PaperClient) PingContext(ctx context.Context) (string, error) {
+	return client.processData(ctx, pingWriter())
 }
 
 // Gets the cache version.
 func (client *PaperClient) Version() (string, error) {
-	writer := initSheetWriter()
-	writer.writeU8(versionByte)
+	return client.VersionContext(context.Background())
+}
 
-	return client.processData(writer)
+// Gets the cache version within the supplied context.
+func (client *PaperClient) VersionContext(ctx context.Context) (string, error) {
+	return client.processData(ctx, versionWriter())
 }
 
 // Attempts to authorize the connection with the supplied auth token.
 // This must match the auth token specified in the server's configured
 // to be successful.
 func (client *PaperClient) Auth(token string) error {
+	return client.AuthContext(context.Background(), token)
+}
+
+// Attempts to authorize the connection with the supplied auth token
+// within the supplied context.
+func (client *PaperClient) AuthContext(ctx context.Context, token string) error {
+	ctx, cancel := withTimeout(ctx, client.config.Timeout)
+	defer cancel()
+
+	if err := client.acquire(ctx); err != nil {
+		return err
+	}
+
+	defer client.release()
+
 	client.auth_token = &token
+	err := client.runCommand(ctx, authWriter(token), nil)
 
-	writer := initSheetWriter()
-	writer.writeU8(authByte)
-	writer.writeString(token)
+	if err != nil {
+		client.authFailed(err)
+	}
 
-	return client.process(writer)
+	return err
 }
 
 // Gets the value of the supplied key from the cache.
 func (client *PaperClient) Get(key string) (string, error) {
-	writer := initSheetWriter()
-	writer.writeU8(getByte)
-	writer.writeString(key)
+	return client.GetContext(context.Background(), key)
+}
 
-	return client.processData(writer)
+// Gets the value of the supplied key from the cache within the supplied
+// context.
+func (client *PaperClient) GetContext(ctx context.Context, key string) (string, error) {
+	return client.processData(ctx, getWriter(key))
+}
+
+// Gets the value of the supplied key from the cache as bytes, without
+// converting it to a string.
+func (client *PaperClient) GetBytes(key string) ([]byte, error) {
+	return client.GetBytesContext(context.Background(), key)
+}
+
+// Gets the value of the supplied key from the cache as bytes within the
+// supplied context.
+func (client *PaperClient) GetBytesContext(ctx context.Context, key string) ([]byte, error) {
+	return client.GetIntoContext(ctx, key, nil)
+}
+
+// Gets the value of the supplied key from the cache, appending it to dst
+// and returning the extended slice. Reusing dst across calls avoids
+// allocating a new slice for each value.
+func (client *PaperClient) GetInto(key string, dst []byte) ([]byte, error) {
+	return client.GetIntoContext(context.Background(), key, dst)
+}
+
+// Gets the value of the supplied key from the cache, appending it to dst
+// within the supplied context.
+func (client *PaperClient) GetIntoContext(ctx context.Context, key string, dst []byte) ([]byte, error) {
+	return client.processBytes(ctx, getWriter(key), dst)
+}
+
+// Gets the value of the supplied key from the cache, streaming it to w as
+// it is read from the server and returning the number of bytes written.
+// Since the value is never held in memory in full, it is not subject to
+// MaxValueSize. If w fails, the rest of the value is discarded so that the
+// connection can still be used, and the error from w is returned.
+func (client *PaperClient) GetTo(key string, w io.Writer) (int64, error) {
+	return client.GetToContext(context.Background(), key, w)
+}
+
+// Gets the value of the supplied key from the cache, streaming it to w
+// within the supplied context.
+func (client *PaperClient) GetToContext(ctx context.Context, key string, w io.Writer) (int64, error) {
+	var written int64
+
+	// part of the value may already have been written to w
+	writer := getWriter(key)
+	writer.disableRetry()
+
+	err := client.request(ctx, writer, func(reader *sheetReader) error {
+		var err error
+		written, err = reader.readStream(w)
+
+		return err
+	})
+
+	return written, err
 }
 
 // Sets the supplied key, value, and TTL to the cache.
 func (client *PaperClient) Set(key string, value string, ttl uint32) error {
+	return client.SetContext(context.Background(), key, value, ttl)
+}
+
+// Sets the supplied key, value, and TTL to the cache within the supplied
+// context.
+func (client *PaperClient) SetContext(ctx context.Context, key string, value string, ttl uint32) error {
+	return client.process(ctx, setWriter(key, value, ttl))
+}
+
+// Sets the supplied key, value as bytes, and TTL to the cache.
+func (client *PaperClient) SetBytes(key string, value []byte, ttl uint32) error {
+	return client.SetBytesContext(context.Background(), key, value, ttl)
+}
+
+// Sets the supplied key, value as bytes, and TTL to the cache within the
+// supplied context.
+func (client *PaperClient) SetBytesContext(ctx context.Context, key string, value []byte, ttl uint32) error {
+	return client.process(ctx, setBytesWriter(key, value, ttl))
+}
+
+// Sets the supplied key and TTL to the cache with a value of the supplied
+// size read from r. The value is streamed to the server as it is read, so
+// it is never held in memory in full. If r fails or ends before size bytes,
+// the connection is closed (the server would otherwise still be waiting
+// for the rest of the value) and replaced on the next command.
+func (client *PaperClient) SetFrom(key string, r io.Reader, size uint32, ttl uint32) error {
+	return client.SetFromContext(context.Background(), key, r, size, ttl)
+}
+
+// Sets the supplied key and TTL to the cache with a value streamed from r
+// within the supplied context.
+func (client *PaperClient) SetFromContext(ctx context.Context, key string, r io.Reader, size uint32, ttl uint32) error {
 	writer := initSheetWriter()
 	writer.writeU8(setByte)
 	writer.writeString(key)
-	writer.writeString(value)
+	writer.writeStream(r, size)
 	writer.writeU32(ttl)
 
-	return client.process(writer)
+	return client.process(ctx, writer)
 }
 
 // Deletes the value of the supplied key from the cache.
 func (client *PaperClient) Del(key string) error {
-	writer := initSheetWriter()
-	writer.writeU8(delByte)
-	writer.writeString(key)
+	return client.DelContext(context.Background(), key)
+}
 
-	return client.process(writer)
+// Deletes the value of the supplied key from the cache within the
+// supplied context.
+func (client *PaperClient) DelContext(ctx context.Context, key string) error {
+	return client.process(ctx, delWriter(key))
 }
 
 // Checks if the cache contains an object with the supplied key
 // without altering the eviction order of the objects.
 func (client *PaperClient) Has(key string) (bool, error) {
-	writer := initSheetWriter()
-	writer.writeU8(hasByte)
-	writer.writeString(key)
+	return client.HasContext(context.Background(), key)
+}
 
-	return client.processHas(writer)
+// Checks if the cache contains an object with the supplied key within
+// the supplied context.
+func (client *PaperClient) HasContext(ctx context.Context, key string) (bool, error) {
+	return client.processHas(ctx, hasWriter(key))
 }
 
 // Gets (peeks) the value of the supplied key from the cache without
 // altering the eviction order of the objects.
 func (client *PaperClient) Peek(key string) (string, error) {
-	writer := initSheetWriter()
-	writer.writeU8(peekByte)
-	writer.writeString(key)
+	return client.PeekContext(context.Background(), key)
+}
 
-	return client.processData(writer)
+// Gets (peeks) the value of the supplied key from the cache within the
+// supplied context.
+func (client *PaperClient) PeekContext(ctx context.Context, key string) (string, error) {
+	return client.processData(ctx, peekWriter(key))
+}
+
+// Gets (peeks) the value of the supplied key from the cache as bytes
+// without altering the eviction order of the objects.
+func (client *PaperClient) PeekBytes(key string) ([]byte, error) {
+	return client.PeekBytesContext(context.Background(), key)
+}
+
+// Gets (peeks) the value of the supplied key from the cache as bytes
+// within the supplied context.
+func (client *PaperClient) PeekBytesContext(ctx context.Context, key string) ([]byte, error) {
+	return client.processBytes(ctx, peekWriter(key), nil)
 }
 
 // Sets the TTL associated with the supplied key.
 func (client *PaperClient) Ttl(key string, ttl uint32) error {
-	writer := initSheetWriter()
-	writer.writeU8(ttlByte)
-	writer.writeString(key)
-	writer.writeU32(ttl)
+	return client.TtlContext(context.Background(), key, ttl)
+}
 
-	return client.process(writer)
+// Sets the TTL associated with the supplied key within the supplied
+// context.
+func (client *PaperClient) TtlContext(ctx context.Context, key string, ttl uint32) error {
+	return client.process(ctx, ttlWriter(key, ttl))
 }
 
 // Gets the size of the value of the supplied key from the cache in bytes.
 func (client *PaperClient) Size(key string) (uint32, error) {
-	writer := initSheetWriter()
-	writer.writeU8(sizeByte)
-	writer.writeString(key)
+	return client.SizeContext(context.Background(), key)
+}
 
-	return client.processSize(writer)
+// Gets the size of the value of the supplied key from the cache in bytes
+// within the supplied context.
+func (client *PaperClient) SizeContext(ctx context.Context, key string) (uint32, error) {
+	return client.processSize(ctx, sizeWriter(key))
 }
 
 // Wipes the contents of the cache.
 func (client *PaperClient) Wipe() error {
-	writer := initSheetWriter()
-	writer.writeU8(wipeByte)
+	return client.WipeContext(context.Background())
+}
 
-	return client.process(writer)
+// Wipes the contents of the cache within the supplied context.
+func (client *PaperClient) WipeContext(ctx context.Context) error {
+	return client.process(ctx, wipeWriter())
 }
 
 // Resizes the cache to the supplied size.
 func (client *PaperClient) Resize(size uint64) error {
-	writer := initSheetWriter()
-	writer.writeU8(resizeByte)
-	writer.writeU64(size)
+	return client.ResizeContext(context.Background(), size)
+}
 
-	return client.process(writer)
+// Resizes the cache to the supplied size within the supplied context.
+func (client *PaperClient) ResizeContext(ctx context.Context, size uint64) error {
+	return client.process(ctx, resizeWriter(size))
 }
 
 // Sets the cache's eviction policy.
 func (client *PaperClient) Policy(policy string) error {
-	writer := initSheetWriter()
-	writer.writeU8(policyByte)
-	writer.writeString(policy)
+	return client.PolicyContext(context.Background(), policy)
+}
 
-	return client.process(writer)
+// Sets the cache's eviction policy within the supplied context.
+func (client *PaperClient) PolicyContext(ctx context.Context, policy string) error {
+	return client.process(ctx, policyWriter(policy))
 }
 
 // Gets the cache's status.
 func (client *PaperClient) Status() (*PaperStatus, error) {
-	writer := initSheetWriter()
-	writer.writeU8(statusByte)
+	return client.StatusContext(context.Background())
+}
 
-	return client.processStatus(writer)
+// Gets the cache's status within the supplied context.
+func (client *PaperClient) StatusContext(ctx context.Context) (*PaperStatus, error) {
+	return client.processStatus(ctx, statusWriter())
 }
 
-func (client *PaperClient) reconnect() (error) {
-	client.reconnect_attempts += 1
+// Replaces the broken connection, making up to MaxReconnects attempts
+// and waiting for the configured backoff before each one. If reconnecting
+// in the background, that is started instead and the command fails.
+func (client *PaperClient) reconnect(ctx context.Context) error {
+	if client.config.BackgroundReconnect {
+		client.reconnectInBackground()
+		return PaperErrorUnreachableServer
+	}
+
+	var err error
+
+	for attempt := uint32(1); attempt <= client.config.MaxReconnects; attempt++ {
+		if err = client.backoff(ctx, attempt); err != nil {
+			return err
+		}
+
+		err = client.redial(ctx, attempt)
+		client.reconnected(attempt, err)
+
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return contextError(ctx, err)
+		}
 
-	if client.reconnect_attempts > maxReconnectAttempts {
-		return PaperErrorMaxConnectionsExceeded
+		if !client.tcp_client.isBroken() {
+			// the server was reached but rejected the auth token, which
+			// another attempt will not change
+			return err
+		}
 	}
 
-	tcp_client, err := tcpClientConnect(client.addr)
+	client.config.logf("giving up after %d reconnect attempts: %v", client.config.MaxReconnects, err)
+	return PaperErrorMaxConnectionsExceeded
+}
 
-	if err != nil {
-		return err
+// Starts a goroutine which reconnects the broken connection, unless one
+// is already running. It must be called while the connection is acquired.
+func (client *PaperClient) reconnectInBackground() {
+	if client.reconnecting {
+		return
 	}
 
-	client.tcp_client = tcp_client
+	client.reconnecting = true
 
-	if client.auth_token != nil {
-		if err := client.Auth(*client.auth_token); err != nil {
-			return err
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go func() {
+			select {
+				case <-client.done:
+					cancel()
+				case <-ctx.Done():
+			}
+		}()
+
+		for attempt := uint32(1); ; attempt++ {
+			if client.backoff(ctx, attempt) != nil {
+				return
+			}
+
+			tcp_client, err := client.dial(ctx, attempt)
+
+			if err != nil {
+				client.reconnected(attempt, err)
+				continue
+			}
+
+			if client.acquire(ctx) != nil {
+				tcp_client.getConn().Close()
+				return
+			}
+
+			err = client.replace(ctx, tcp_client)
+			client.reconnected(attempt, err)
+
+			if err == nil || !client.tcp_client.isBroken() {
+				client.reconnecting = false
+				client.release()
+
+				return
+			}
+
+			client.release()
 		}
+	}()
+}
+
+// Dials a new connection and replaces the broken one with it.
+func (client *PaperClient) redial(ctx context.Context, attempt uint32) error {
+	tcp_client, err := client.dial(ctx, attempt)
+
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return client.replace(ctx, tcp_client)
 }
 
-func (client *PaperClient) process(writer *sheetWriter) error {
-	err := client.tcp_client.send(writer)
+func (client *PaperClient) dial(ctx context.Context, attempt uint32) (*tcpClient, error) {
+	client.config.logf("reconnecting to %s (attempt %d)", client.addr.host, attempt)
+	tcp_client, err := tcpClientConnect(ctx, client.addr, client.config)
 
 	if err != nil {
-		if err := client.reconnect(); err != nil {
-			return err
-		}
+		client.config.logf("could not reconnect to %s: %v", client.addr.host, err)
+	}
 
-		return client.process(writer)
+	return tcp_client, err
+}
+
+// Swaps in the new connection and authorizes it if the client had been
+// authorized. It must be called while the connection is acquired.
+func (client *PaperClient) replace(ctx context.Context, tcp_client *tcpClient) error {
+	client.conn_lock.Lock()
+	client.tcp_client.getConn().Close()
+	client.tcp_client = tcp_client
+	client.conn_lock.Unlock()
+
+	if client.isClosed() {
+		tcp_client.getConn().Close()
+		return PaperErrorClosed
 	}
 
-	client.reconnect_attempts = 0
-	reader := initSheetReader(client.tcp_client)
+	if client.auth_token == nil {
+		return nil
+	}
 
-	is_ok, err := reader.readBool()
+	err := client.attempt(ctx, authWriter(*client.auth_token), func(reader *sheetReader) error {
+		return readResponse(reader, nil)
+	})
 
 	if err != nil {
-		return err
+		client.config.logf("could not authorize reconnected client: %v", err)
+		client.authFailed(err)
 	}
 
-	if !is_ok {
-		return errorFromReader(reader)
+	return err
+}
+
+// Waits for the configured backoff before the supplied reconnect attempt.
+func (client *PaperClient) backoff(ctx context.Context, attempt uint32) error {
+	if client.config.Backoff == nil {
+		return nil
 	}
 
-	return nil
+	return client.sleep(ctx, client.config.Backoff(attempt))
 }
 
-func (client *PaperClient) processData(writer *sheetWriter) (string, error) {
-	err := client.tcp_client.send(writer)
+func (client *PaperClient) isClosed() bool {
+	select {
+		case <-client.done:
+			return true
+		default:
+			return false
+	}
+}
 
-	if err != nil {
-		if err := client.reconnect(); err != nil {
-			return "", err
-		}
+// Checks if the connection failed during the last command, meaning it
+// must be reconnected before the next one.
+func (client *PaperClient) isBroken() bool {
+	client.lock <- struct{}{}
+	defer client.release()
+
+	return client.tcp_client.isBroken()
+}
 
-		return client.processData(writer)
+// Waits for the supplied duration or until the context is done or the
+// client is closed.
+func (client *PaperClient) sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
 	}
 
-	client.reconnect_attempts = 0
-	reader := initSheetReader(client.tcp_client)
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
 
-	is_ok, err := reader.readBool()
+	select {
+		case <-timer.C:
+			return nil
 
-	if err != nil {
-		return "", err
+		case <-client.done:
+			return PaperErrorClosed
+
+		case <-ctx.Done():
+			return ctx.Err()
 	}
+}
 
-	if !is_ok {
-		return "", errorFromReader(reader)
+// Acquires exclusive use of the connection, giving up if the context is
+// done first.
+func (client *PaperClient) acquire(ctx context.Context) error {
+	select {
+		case client.lock <- struct{}{}:
+			return nil
+
+		case <-client.done:
+			return PaperErrorClosed
+
+		case <-ctx.Done():
+			return ctx.Err()
 	}
+}
 
-	return reader.readString()
+func (client *PaperClient) release() {
+	<-client.lock
 }
 
-func (client *PaperClient) processHas(writer *sheetWriter) (bool, error) {
-	err := client.tcp_client.send(writer)
+// Sends the request to the server and reads the response header. If the
+// server responded successfully, the remainder of the response is passed
+// to the supplied function. The context (bounded by the configured
+// timeout) covers waiting for the connection and the whole exchange.
+func (client *PaperClient) request(ctx context.Context, writer *sheetWriter, read func(*sheetReader) error) error {
+	ctx, cancel := withTimeout(ctx, client.config.Timeout)
+	defer cancel()
 
-	if err != nil {
-		if err := client.reconnect(); err != nil {
-			return false, err
-		}
+	if err := client.acquire(ctx); err != nil {
+		return err
+	}
+
+	defer client.release()
 
-		return client.processHas(writer)
+	return client.runCommand(ctx, writer, read)
+}
+
+// Runs a single command while the connection is acquired.
+func (client *PaperClient) runCommand(ctx context.Context, writer *sheetWriter, read func(*sheetReader) error) error {
+	command := commandNames[writer.getBuf()[0]]
+
+	return client.run(ctx, command, writer, func(reader *sheetReader) error {
+		return readResponse(reader, read)
+	})
+}
+
+// Sends the writer's requests while the connection is acquired and passes
+// the connection's reader to the supplied function to read the responses.
+// The context is bounded by the configured timeout if it is not already.
+func (client *PaperClient) run(ctx context.Context, command string, writer *sheetWriter, receive func(*sheetReader) error) error {
+	ctx, cancel := withTimeout(ctx, client.config.Timeout)
+	defer cancel()
+
+	on_command := client.config.Hooks.OnCommand
+
+	if on_command == nil {
+		return client.exchangeThroughBreaker(ctx, command, writer, receive)
 	}
 
-	client.reconnect_attempts = 0
-	reader := initSheetReader(client.tcp_client)
+	start := time.Now()
+	err := client.exchangeThroughBreaker(ctx, command, writer, receive)
 
-	is_ok, err := reader.readBool()
+	on_command(command, time.Since(start), err)
+
+	return err
+}
+
+// Exchanges the writer's requests unless the configured circuit breaker
+// is open, recording the outcome with the breaker.
+func (client *PaperClient) exchangeThroughBreaker(ctx context.Context, command string, writer *sheetWriter, receive func(*sheetReader) error) error {
+	breaker := client.config.CircuitBreaker
+
+	if breaker == nil {
+		return client.exchangeWithRetries(ctx, command, writer, receive)
+	}
+
+	generation, err := breaker.allow()
 
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	if !is_ok {
-		return false, errorFromReader(reader)
+	start := time.Now()
+	err = client.exchangeWithRetries(ctx, command, writer, receive)
+
+	breaker.record(generation, client.circuitOutcome(err), time.Since(start))
+
+	return err
+}
+
+// Classifies the error by whether it reflects on the server's health. The
+// connection failing or timing out is a failure. The server rejecting the
+// command is a success, since the server responded. The caller giving up,
+// the client being closed or the response being too large says nothing
+// about the server either way.
+func (client *PaperClient) circuitOutcome(err error) circuitOutcome {
+	switch err {
+		case nil:
+			return circuitSuccess
+
+		case context.Canceled, PaperErrorClosed, PaperErrorResponseTooLarge:
+			return circuitIgnored
+
+		case context.DeadlineExceeded, PaperErrorMaxConnectionsExceeded, PaperErrorUnreachableServer:
+			return circuitFailure
 	}
 
-	return reader.readBool()
+	if client.tcp_client.isBroken() {
+		return circuitFailure
+	}
+
+	return circuitSuccess
 }
 
-func (client *PaperClient) processSize(writer *sheetWriter) (uint32, error) {
-	err := client.tcp_client.send(writer)
+// Exchanges the writer's requests, retrying them on a new connection for
+// as long as the configured RetryPolicy allows if they fail with a
+// transient network error.
+func (client *PaperClient) exchangeWithRetries(ctx context.Context, command string, writer *sheetWriter, receive func(*sheetReader) error) error {
+	for attempt := uint32(1); ; attempt++ {
+		err := client.exchange(ctx, writer, receive)
 
-	if err != nil {
-		if err := client.reconnect(); err != nil {
-			return 0, err
+		if err == nil || !client.retry(ctx, command, writer, attempt, err) {
+			return err
 		}
+	}
+}
 
-		return client.processSize(writer)
+// Checks if the command should be retried after the supplied attempt
+// failed, waiting for the policy's delay if so.
+func (client *PaperClient) retry(ctx context.Context, command string, writer *sheetWriter, attempt uint32, err error) bool {
+	policy := client.config.RetryPolicy
+
+	if policy == nil || !writer.canRetry() || !client.isTransient(ctx, err) {
+		return false
 	}
 
-	client.reconnect_attempts = 0
-	reader := initSheetReader(client.tcp_client)
+	retry, delay := policy.ShouldRetry(command, attempt, err)
 
-	is_ok, err := reader.readBool()
+	if !retry {
+		return false
+	}
 
-	if err != nil {
-		return 0, err
+	client.config.logf("retrying %s after attempt %d failed: %v", command, attempt, err)
+
+	return client.sleep(ctx, delay) == nil
+}
+
+// Checks if the error broke the connection in a way which a new connection
+// may not, as opposed to the server rejecting the command, the context
+// being done, or reconnecting having already failed.
+func (client *PaperClient) isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || client.isClosed() || !client.tcp_client.isBroken() {
+		return false
 	}
 
-	if !is_ok {
-		return 0, errorFromReader(reader)
+	switch err {
+		case PaperErrorResponseTooLarge,
+			PaperErrorMaxConnectionsExceeded,
+			PaperErrorUnreachableServer,
+			PaperErrorClosed:
+
+			return false
 	}
 
-	return reader.readU32()
+	var net_err net.Error
+
+	if errors.As(err, &net_err) && net_err.Timeout() {
+		return false
+	}
+
+	return true
 }
 
-func (client *PaperClient) processStatus(writer *sheetWriter) (*PaperStatus, error) {
-	err := client.tcp_client.send(writer)
+// Sends the writer's requests, reconnecting first if the connection is
+// broken, and then receives the responses. If the context is done midway,
+// the connection is marked as broken and replaced on the next request.
+// Requests are never sent again here, since part of them may already have
+// reached the server; the RetryPolicy decides whether they are retried.
+func (client *PaperClient) exchange(ctx context.Context, writer *sheetWriter, receive func(*sheetReader) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	if err != nil {
-		if err := client.reconnect(); err != nil {
-			return nil, err
+	if client.isClosed() {
+		return PaperErrorClosed
+	}
+
+	if client.tcp_client.isBroken() {
+		if err := client.reconnect(ctx); err != nil {
+			return err
 		}
+	}
+
+	err := client.attempt(ctx, writer, receive)
+
+	if err != nil && client.tcp_client.isBroken() {
+		client.lost(err)
+	}
+
+	if client.config.BackgroundReconnect && client.tcp_client.isBroken() {
+		client.reconnectInBackground()
+	}
+
+	return err
+}
+
+// Sends the writer's requests and receives the responses over the current
+// connection without reconnecting.
+func (client *PaperClient) attempt(ctx context.Context, writer *sheetWriter, receive func(*sheetReader) error) error {
+	stop := client.tcp_client.watch(ctx)
+	defer stop()
+
+	if err := client.tcp_client.send(writer); err != nil {
+		return contextError(ctx, err)
+	}
+
+	err := receive(client.tcp_client.getReader())
 
-		return client.processStatus(writer)
+	if err != nil && client.tcp_client.isBroken() {
+		return contextError(ctx, err)
 	}
 
-	client.reconnect_attempts = 0
-	reader := initSheetReader(client.tcp_client)
+	return err
+}
 
+// Reads a single response. If the server responded successfully, the
+// remainder of the response is passed to the supplied function.
+func readResponse(reader *sheetReader, read func(*sheetReader) error) error {
+	reader.startResponse()
 	is_ok, err := reader.readBool()
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if !is_ok {
-		return nil, errorFromReader(reader)
+		return errorFromReader(reader)
+	}
+
+	if read == nil {
+		return nil
 	}
 
-	return statusFromReader(reader)
+	return read(reader)
 }
 
-func parsePaperAddr(paper_addr string) (*string, error) {
-	if !strings.HasPrefix(paper_addr, "paper://") {
-		return nil, errors.New("Invalid paper address.")
-	}
+func (client *PaperClient) process(ctx context.Context, writer *sheetWriter) error {
+	return client.request(ctx, writer, nil)
+}
 
-	addr := strings.Replace(paper_addr, "paper://", "", 1)
+func (client *PaperClient) processData(ctx context.Context, writer *sheetWriter) (string, error) {
+	var data string
+
+	err := client.request(ctx, writer, func(reader *sheetReader) error {
+		var err error
+		data, err = reader.readString()
+
+		return err
+	})
+
+	return data, err
+}
+
+func (client *PaperClient) processBytes(ctx context.Context, writer *sheetWriter, dst []byte) ([]byte, error) {
+	data := dst
+
+	err := client.request(ctx, writer, func(reader *sheetReader) error {
+		var err error
+		data, err = reader.appendBytes(dst)
+
+		return err
+	})
+
+	return data, err
+}
+
+func (client *PaperClient) processHas(ctx context.Context, writer *sheetWriter) (bool, error) {
+	var has bool
+
+	err := client.request(ctx, writer, func(reader *sheetReader) error {
+		var err error
+		has, err = reader.readBool()
+
+		return err
+	})
+
+	return has, err
+}
+
+func (client *PaperClient) processSize(ctx context.Context, writer *sheetWriter) (uint32, error) {
+	var size uint32
+
+	err := client.request(ctx, writer, func(reader *sheetReader) error {
+		var err error
+		size, err = reader.readU32()
+
+		return err
+	})
+
+	return size, err
+}
+
+func (client *PaperClient) processStatus(ctx context.Context, writer *sheetWriter) (*PaperStatus, error) {
+	var status *PaperStatus
+
+	err := client.request(ctx, writer, func(reader *sheetReader) error {
+		var err error
+		status, err = statusFromReader(reader)
+
+		return err
+	})
 
-	return &addr, nil
+	return status, err
 }
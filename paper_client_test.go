@@ -8,9 +8,18 @@
 package paperclient
 
 import (
+	"io"
+	"fmt"
+	"net"
+	"sync"
+	"bytes"
+	"errors"
+	"strings"
+	"path/filepath"
 	"testing"
 	"time"
 	"math"
+	"context"
 )
 
 func TestPing(t *testing.T) {
@@ -96,6 +105,146 @@ func TestGetNonExistent(t *testing.T) {
 	}
 }
 
+func TestGetBytesExistent(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	value := []byte { 0, 1, 2, 255, 'v' }
+
+	client.SetBytes("key", value, 0)
+	response, err := client.GetBytes("key")
+
+	if err != nil {
+		t.Error("get bytes returned an error for a key which exists")
+	}
+
+	if !bytes.Equal(response, value) {
+		t.Errorf("get bytes returned %v instead of %v", response, value)
+	}
+}
+
+func TestGetBytesNonExistent(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	_, err := client.GetBytes("key")
+
+	if err != PaperErrorKeyNotFound {
+		t.Error("get bytes for key which does not exist did not return correct error")
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	client.Set("key", "value", 0)
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, "prefix:"...)
+
+	response, err := client.GetInto("key", buf)
+
+	if err != nil {
+		t.Error("get into returned an error for a key which exists")
+	}
+
+	if string(response) != "prefix:value" {
+		t.Errorf("get into returned %q instead of \"prefix:value\"", response)
+	}
+
+	if &response[0] != &buf[0] {
+		t.Error("get into did not reuse the supplied buffer")
+	}
+
+	response, err = client.GetInto("other", buf)
+
+	if err != PaperErrorKeyNotFound {
+		t.Error("get into for key which does not exist did not return correct error")
+	}
+
+	if string(response) != "prefix:" {
+		t.Error("get into for key which does not exist modified the buffer")
+	}
+}
+
+func TestSetFromGetTo(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	value := strings.Repeat("value", 100000)
+	err := client.SetFrom("key", strings.NewReader(value), uint32(len(value)), 0)
+
+	if err != nil {
+		t.Error("set from returned an error")
+	}
+
+	var buf bytes.Buffer
+	written, err := client.GetTo("key", &buf)
+
+	if err != nil {
+		t.Error("get to returned an error for a key which exists")
+	}
+
+	if written != int64(len(value)) || buf.String() != value {
+		t.Errorf("get to wrote %d bytes instead of %d", written, len(value))
+	}
+}
+
+func TestSetFromShortReader(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	err := client.SetFrom("key", strings.NewReader("short"), 100, 0)
+
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("set from a short reader returned %v", err)
+	}
+
+	if !client.tcp_client.isBroken() {
+		t.Error("connection was not marked as broken after a partial value")
+	}
+
+	has, err := client.Has("key")
+
+	if err != nil {
+		t.Error("has returned an error after a partial value")
+	}
+
+	if has {
+		t.Error("partial value was set")
+	}
+}
+
+func TestGetToWriterError(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	value := strings.Repeat("value", 10000)
+	client.Set("key", value, 0)
+
+	writer := &failingWriter { limit: 100 }
+	written, err := client.GetTo("key", writer)
+
+	if err != errWriterFull {
+		t.Errorf("get to a failing writer returned %v", err)
+	}
+
+	if written != 100 {
+		t.Errorf("get to a failing writer wrote %d bytes instead of 100", written)
+	}
+
+	if client.tcp_client.isBroken() {
+		t.Error("connection was marked as broken after the writer failed")
+	}
+
+	response, err := client.Get("key")
+
+	if err != nil || response != value {
+		t.Error("get after a failing writer did not return the value")
+	}
+}
+
 func TestSetNoTtl(t *testing.T) {
 	client := initClient(t, true)
 	defer client.Disconnect()
@@ -240,6 +389,22 @@ func TestPeekNonExistent(t *testing.T) {
 	}
 }
 
+func TestPeekBytesExistent(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	client.Set("key", "value", 0)
+	response, err := client.PeekBytes("key")
+
+	if err != nil {
+		t.Error("peek bytes returned an error for a key which exists")
+	}
+
+	if string(response) != "value" {
+		t.Errorf("peek bytes return %q instead of \"value\"", response)
+	}
+}
+
 func TestTtlExistent(t *testing.T) {
 	client := initClient(t, true)
 	defer client.Disconnect()
@@ -406,6 +571,422 @@ func TestReconnect(t *testing.T) {
 	}
 }
 
+func TestReconnectWithoutRetries(t *testing.T) {
+	client, err := ClientConnect("paper://127.0.0.1:3145", WithRetryPolicy(nil))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Disconnect()
+
+	client.Auth("auth_token")
+	size := getCacheSize(client)
+
+	client.Disconnect()
+
+	if err := client.Resize(size); err != nil {
+		t.Errorf("resize returned %v after disconnect", err)
+	}
+
+	client.Disconnect()
+
+	if _, err := client.Has("key"); err != nil {
+		t.Errorf("has returned %v after disconnect without retries", err)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	var wait_group sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wait_group.Add(1)
+
+		go func(i int) {
+			defer wait_group.Done()
+
+			for j := 0; j < 50; j++ {
+				key := fmt.Sprintf("key_%d_%d", i, j)
+				value := fmt.Sprintf("value_%d_%d", i, j)
+
+				if err := client.Set(key, value, 0); err != nil {
+					t.Errorf("concurrent set returned an error: %v", err)
+					return
+				}
+
+				response, err := client.Get(key)
+
+				if err != nil {
+					t.Errorf("concurrent get returned an error: %v", err)
+					return
+				}
+
+				if response != value {
+					t.Errorf("concurrent get returned %q instead of %q", response, value)
+					return
+				}
+
+				if j == 25 {
+					client.Disconnect()
+				}
+			}
+		}(i)
+	}
+
+	wait_group.Wait()
+}
+
+func TestConcurrentWaitCancelled(t *testing.T) {
+	client := initStalledClient(t)
+	defer client.Disconnect()
+
+	go client.Get("key")
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	_, err := client.PingContext(ctx)
+
+	if err != context.DeadlineExceeded {
+		t.Error("waiting for a busy client did not return the context's error")
+	}
+}
+
+func TestContextCancelled(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetContext(ctx, "key")
+
+	if err != context.Canceled {
+		t.Error("get with a cancelled context did not return the context's error")
+	}
+
+	_, err = client.Has("key")
+
+	if err != nil {
+		t.Error("has returned an error after a cancelled request")
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	client := initStalledClient(t)
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetContext(ctx, "key")
+
+	if err != context.DeadlineExceeded {
+		t.Error("get on a stalled server did not return the context's deadline error")
+	}
+
+	if !client.tcp_client.isBroken() {
+		t.Error("connection was not marked as broken after the deadline passed")
+	}
+
+	response, err := client.Ping()
+
+	if err != nil {
+		t.Error("ping returned an error after the deadline passed")
+	}
+
+	if response != "pong" {
+		t.Error("ping did not return pong after reconnecting")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := initUnixServer(t)
+
+	client, err := ClientConnect("paper+unix://" + path)
+
+	if err != nil {
+		t.Fatal("could not connect client over a unix socket")
+	}
+
+	defer client.Disconnect()
+
+	client.Disconnect()
+	response, err := client.Ping()
+
+	if err != nil {
+		t.Error("ping returned an error after reconnecting over a unix socket")
+	}
+
+	if response != "pong" {
+		t.Error("ping did not return pong after reconnecting over a unix socket")
+	}
+}
+
+func TestReconnectAfterRestart(t *testing.T) {
+	server := initRestartableServer(t)
+
+	client, err := ClientConnect(
+		server.addr,
+		WithMaxReconnects(2),
+		WithBackoff(ConstantBackoff(5 * time.Millisecond)),
+	)
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	server.stop()
+	client.Disconnect()
+
+	if _, err := client.Ping(); err != PaperErrorMaxConnectionsExceeded {
+		t.Errorf("ping returned %v instead of PaperErrorMaxConnectionsExceeded while the server was down", err)
+	}
+
+	server.start()
+
+	if response, err := client.Ping(); err != nil || response != "pong" {
+		t.Errorf("ping returned %q, %v after the server restarted", response, err)
+	}
+}
+
+func TestBackgroundReconnect(t *testing.T) {
+	server := initRestartableServer(t)
+
+	client, err := ClientConnect(
+		server.addr,
+		WithBackgroundReconnect(),
+		WithBackoff(ConstantBackoff(5 * time.Millisecond)),
+	)
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	server.stop()
+	client.Disconnect()
+
+	if _, err := client.Ping(); err != PaperErrorUnreachableServer {
+		t.Errorf("ping returned %v instead of PaperErrorUnreachableServer while reconnecting in the background", err)
+	}
+
+	server.start()
+
+	for i := 0; i < 100; i++ {
+		if response, _ := client.Ping(); response == "pong" {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("client did not reconnect in the background after the server restarted")
+}
+
+func TestClose(t *testing.T) {
+	client := initClient(t, false)
+	client.Close()
+
+	if _, err := client.Ping(); err != PaperErrorClosed {
+		t.Errorf("ping returned %v instead of PaperErrorClosed after close", err)
+	}
+
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	pool.Close()
+
+	if _, err := pool.Ping(); err != PaperErrorClosed {
+		t.Errorf("pool ping returned %v instead of PaperErrorClosed after close", err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10 * time.Millisecond, 50 * time.Millisecond)
+	expected := []time.Duration { 10, 20, 40, 50, 50 }
+
+	for i, delay := range expected {
+		if actual := backoff(uint32(i + 1)); actual != delay * time.Millisecond {
+			t.Errorf("backoff for attempt %d was %v instead of %v", i + 1, actual, delay * time.Millisecond)
+		}
+	}
+
+	jittered := JitterBackoff(ConstantBackoff(100 * time.Millisecond), 0.2)
+
+	for i := 0; i < 100; i++ {
+		if delay := jittered(1); delay < 80 * time.Millisecond || delay > 120 * time.Millisecond {
+			t.Errorf("jittered backoff was %v, outside of 80ms to 120ms", delay)
+		}
+	}
+}
+
+func TestStateHooks(t *testing.T) {
+	server := initRestartableServer(t)
+
+	var lock sync.Mutex
+	events := []string{}
+
+	record := func(event string) {
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}
+
+	client, err := ClientConnect(
+		server.addr,
+		WithMaxReconnects(2),
+		WithBackoff(nil),
+		WithHooks(Hooks {
+			OnConnect: func(host string) {
+				record("connect")
+			},
+
+			OnDisconnect: func(err error) {
+				record(fmt.Sprintf("disconnect %v", err))
+			},
+
+			OnReconnect: func(attempt uint32, err error) {
+				record(fmt.Sprintf("reconnect %d %t", attempt, err == nil))
+			},
+		}),
+	)
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	if client.State() != StateReady {
+		t.Errorf("client state was %v instead of ready after connecting", client.State())
+	}
+
+	server.stop()
+	client.Disconnect()
+
+	if client.State() != StateReconnecting {
+		t.Errorf("client state was %v instead of reconnecting after disconnecting", client.State())
+	}
+
+	client.Ping()
+	server.start()
+	client.Ping()
+
+	if client.State() != StateReady {
+		t.Errorf("client state was %v instead of ready after reconnecting", client.State())
+	}
+
+	client.Close()
+
+	if client.State() != StateClosed {
+		t.Errorf("client state was %v instead of closed after closing", client.State())
+	}
+
+	expected := []string {
+		"connect",
+		"disconnect <nil>",
+		"reconnect 1 false",
+		"reconnect 2 false",
+		"reconnect 1 true",
+		"connect",
+		"disconnect <nil>",
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if strings.Join(events, ",") != strings.Join(expected, ",") {
+		t.Errorf("hooks observed %v instead of %v", events, expected)
+	}
+}
+
+func TestAuthFailureHook(t *testing.T) {
+	var auth_err error
+
+	client, err := ClientConnect(
+		"paper://127.0.0.1:3145",
+		WithHooks(Hooks {
+			OnAuthFailure: func(err error) {
+				auth_err = err
+			},
+		}),
+	)
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	client.Auth("invalid_token")
+
+	if auth_err != PaperErrorUnauthorized {
+		t.Errorf("auth failure hook observed %v instead of PaperErrorUnauthorized", auth_err)
+	}
+}
+
+func TestPoolState(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+
+	if pool.State() != StateReady {
+		t.Errorf("pool state was %v instead of ready", pool.State())
+	}
+
+	pool.Close()
+
+	if pool.State() != StateClosed {
+		t.Errorf("pool state was %v instead of closed after closing", pool.State())
+	}
+}
+
+func TestPoolStateHooks(t *testing.T) {
+	var lock sync.Mutex
+	events := []string{}
+
+	record := func(event string) {
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}
+
+	pool, err := PoolConnect(
+		initStalledServer(t),
+		2,
+		WithPoolMinSize(2),
+		WithPoolMaxLifetime(20 * time.Millisecond),
+		WithHooks(Hooks {
+			OnConnect: func(host string) {
+				record("connect")
+			},
+
+			OnDisconnect: func(err error) {
+				record(fmt.Sprintf("disconnect %v", err))
+			},
+		}),
+	)
+
+	if err != nil {
+		t.Fatal("Could not connect pool")
+	}
+
+	// the pool recycles its connections several times meanwhile
+	time.Sleep(100 * time.Millisecond)
+	pool.Close()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	expected := []string { "connect", "disconnect <nil>" }
+
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("pool hooks recorded %v instead of %v", events, expected)
+	}
+}
+
 func initClient(t *testing.T, authorize bool) (*PaperClient) {
 	client, err := ClientConnect("paper://127.0.0.1:3145")
 
@@ -435,3 +1016,140 @@ func getCachePolicy(client *PaperClient) (string) {
 	status, _ := client.Status()
 	return status.policy
 }
+
+// Connects to a server which answers the first command on each connection
+// with a pong and never responds to anything after that.
+func initStalledClient(t *testing.T) (*PaperClient) {
+	client, err := ClientConnect(initStalledServer(t))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	return client
+}
+
+// Starts a server which answers the first command on each connection with
+// a pong and never responds to anything after that, returning its address.
+func initStalledServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal("Could not start stalled server")
+	}
+
+	serve(t, listener)
+
+	return "paper://" + listener.Addr().String()
+}
+
+// Answers the first command on each connection accepted by the listener
+// with a pong until the listener is closed, which happens once the test
+// is over.
+func serve(t *testing.T, listener net.Listener) {
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go serveStalled(conn)
+		}
+	}()
+}
+
+func serveStalled(conn net.Conn) {
+	defer conn.Close()
+
+	command := make([]byte, 1)
+
+	if _, err := conn.Read(command); err != nil {
+		return
+	}
+
+	writer := initSheetWriter()
+	writer.writeU8('!')
+	writer.writeString("pong")
+
+	conn.Write(writer.getBuf())
+	io.Copy(io.Discard, conn)
+}
+
+// Starts a server on a unix socket which answers the first command on each
+// connection with a pong, returning the socket's path.
+func initUnixServer(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "paper.sock")
+	listener, err := net.Listen("unix", path)
+
+	if err != nil {
+		t.Fatal("Could not start unix server")
+	}
+
+	serve(t, listener)
+
+	return path
+}
+
+var errWriterFull = errors.New("writer full")
+
+// Accepts up to limit bytes and then fails.
+type failingWriter struct {
+	limit int
+}
+
+func (writer *failingWriter) Write(data []byte) (int, error) {
+	if len(data) > writer.limit {
+		count := writer.limit
+		writer.limit = 0
+
+		return count, errWriterFull
+	}
+
+	writer.limit -= len(data)
+	return len(data), nil
+}
+
+type restartableServer struct {
+	t *testing.T
+	addr string
+	host string
+	listener net.Listener
+}
+
+// Starts a server like initStalledServer which can be stopped and started
+// again on the same address.
+func initRestartableServer(t *testing.T) *restartableServer {
+	server := &restartableServer {
+		t: t,
+		host: "127.0.0.1:0",
+	}
+
+	server.start()
+	server.host = server.listener.Addr().String()
+	server.addr = "paper://" + server.host
+
+	t.Cleanup(server.stop)
+
+	return server
+}
+
+func (server *restartableServer) start() {
+	listener, err := net.Listen("tcp", server.host)
+
+	if err != nil {
+		server.t.Fatal("Could not start server")
+	}
+
+	server.listener = listener
+	serve(server.t, listener)
+}
+
+func (server *restartableServer) stop() {
+	server.listener.Close()
+}
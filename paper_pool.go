@@ -8,80 +8,1001 @@
 package paperclient
 
 import (
+	"io"
 	"sync"
-	"sync/atomic"
+	"time"
+	"errors"
+	"context"
 )
 
+// A pool of clients which can be acquired by one caller at a time. The
+// pool opens connections as they are needed, up to its size, and closes
+// them again once they have been idle or open for too long. A PaperPool
+// is safe for concurrent use.
 type PaperPool struct {
-	clients []*LockableClient
-	index uint32
+	addr paperAddr
+	config *Config
+
+	// The configuration the pool's clients connect with, whose OnConnect
+	// and OnDisconnect hooks report the pool's state as a whole.
+	client_config *Config
+
+	// The State last reported through the hooks, accessed atomically.
+	hook_state uint32
+
+	size uint32
+	min_size uint32
+
+	// Holds one token for each open connection, so that at most size
+	// connections are ever open.
+	slots chan struct{}
+	idle chan *poolConn
+
+	conns map[*PaperClient]*poolConn
+	auth_token *string
+	lock sync.Mutex
+
+	done chan struct{}
+	disconnect_once sync.Once
+
+	// Closed by Close, after which clients can no longer be acquired.
+	closed chan struct{}
+	close_once sync.Once
+}
+
+type poolConn struct {
+	client *PaperClient
+	created_at time.Time
+	released_at time.Time
+
+	// The number of consecutive health checks the connection has failed.
+	failures uint32
 }
 
+// A client checked out of a pool through the LockableClient API.
+//
+// Deprecated: use PaperPool.Acquire and PaperPool.Release, or PaperPool.Do.
 type LockableClient struct {
+	pool *PaperPool
+
+	// Held from Lock until Unlock, so that a handle shared by several
+	// goroutines is used by one of them at a time, as it was when each
+	// handle wrapped a single connection. client is only accessed while
+	// it is held.
+	lock sync.Mutex
 	client *PaperClient
-	lock *sync.Mutex
 }
 
-func PoolConnect(paper_addr string, size uint32) (*PaperPool, error) {
-	clients := []*LockableClient{}
+// Connects a pool of clients to the PaperCache server at the provided
+// address. The size is the maximum number of connections the pool opens.
+// If it is zero, the configured pool size is used.
+func PoolConnect(paper_addr string, size uint32, opts ...Option) (*PaperPool, error) {
+	addr, config, err := initConfig(paper_addr, DefaultConfig(), opts)
 
-	for i := uint32(0); i < size; i++ {
-		client, err := ClientConnect(paper_addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return poolConnect(*addr, size, config)
+}
+
+// Connects a pool of clients to the PaperCache server at the provided
+// address using the supplied configuration, which should start from
+// DefaultConfig. A zero MaxReconnects or PoolSize uses the default.
+func PoolConnectWithConfig(paper_addr string, config Config) (*PaperPool, error) {
+	config.applyDefaults()
+
+	addr, config_ptr, err := initConfig(paper_addr, config, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return poolConnect(*addr, 0, config_ptr)
+}
+
+// Opens the pool's minimum number of connections (and at least one, so
+// that an unreachable server is reported straight away). If any of them
+// cannot be opened, those which were are closed.
+func poolConnect(addr paperAddr, size uint32, config *Config) (*PaperPool, error) {
+	if size == 0 {
+		size = config.PoolSize
+	}
+
+	if size == 0 {
+		return nil, errors.New("Invalid pool size.")
+	}
+
+	min_size := config.PoolMinSize
+
+	if min_size > size {
+		min_size = size
+	}
+
+	pool := &PaperPool {
+		addr: addr,
+		config: config,
+
+		size: size,
+		min_size: min_size,
+
+		slots: make(chan struct{}, size),
+		idle: make(chan *poolConn, size),
+
+		conns: make(map[*PaperClient]*poolConn),
+
+		done: make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+
+	pool.client_config = pool.clientConfig()
+
+	initial_size := min_size
+
+	if initial_size == 0 {
+		initial_size = 1
+	}
+
+	for i := uint32(0); i < initial_size; i++ {
+		pool.slots <- struct{}{}
+		conn, err := pool.open(context.Background())
 
 		if err != nil {
+			pool.Close()
 			return nil, err
 		}
 
-		lock := &sync.Mutex{}
+		pool.idle <- conn
+	}
+
+	if interval := pool.reapInterval(); interval > 0 {
+		go pool.reap(interval)
+	}
+
+	if interval := config.PoolHealthCheckInterval; interval > 0 {
+		go pool.checkHealth(interval)
+	}
+
+	return pool, nil
+}
+
+// Disconnects every client, including those which are acquired, and stops
+// closing idle connections in the background.
+func (pool *PaperPool) Disconnect() {
+	pool.disconnect_once.Do(func() {
+		close(pool.done)
+	})
+
+	for _, client := range pool.clients() {
+		client.Disconnect()
+	}
+}
+
+// Closes every client for good, including those which are acquired. Later
+// commands, and acquiring a client, fail with PaperErrorClosed.
+func (pool *PaperPool) Close() {
+	pool.close_once.Do(func() {
+		close(pool.closed)
+	})
+
+	pool.Disconnect()
+
+	for _, client := range pool.clients() {
+		client.Close()
+	}
+
+	// reported here too in case the pool had no connections open
+	pool.disconnected(nil)
+}
+
+// Authorizes every client in the pool with the supplied token, returning
+// the first error. Connections opened later are authorized with the same
+// token.
+func (pool *PaperPool) Auth(token string) error {
+	return pool.AuthContext(context.Background(), token)
+}
+
+// Authorizes every client in the pool with the supplied token within the
+// supplied context.
+func (pool *PaperPool) AuthContext(ctx context.Context, token string) error {
+	pool.lock.Lock()
+	pool.auth_token = &token
+	pool.lock.Unlock()
+
+	var first_err error
+
+	for _, client := range pool.clients() {
+		if err := client.AuthContext(ctx, token); err != nil && first_err == nil {
+			first_err = err
+		}
+	}
+
+	return first_err
+}
+
+// Acquires an idle client, opening a new connection if none are idle and
+// the pool is not yet full, or otherwise waiting for one to be released.
+// Waiting callers are served in the order they arrived. The client must be
+// returned with Release once the caller is done with it.
+func (pool *PaperPool) Acquire(ctx context.Context) (*PaperClient, error) {
+	if breaker := pool.config.CircuitBreaker; breaker != nil && breaker.isOpen() {
+		return nil, PaperErrorCircuitOpen
+	}
+
+	var timeout <-chan time.Time
+
+	for {
+		if pool.isClosed() {
+			return nil, PaperErrorClosed
+		}
+
+		select {
+			case conn := <-pool.idle:
+				if pool.expired(conn, time.Now()) {
+					pool.close(conn)
+					continue
+				}
+
+				return conn.client, nil
+
+			default:
+		}
+
+		if timeout == nil && pool.config.PoolTimeout > 0 {
+			timer := time.NewTimer(pool.config.PoolTimeout)
+			defer timer.Stop()
+
+			timeout = timer.C
+		}
+
+		select {
+			case conn := <-pool.idle:
+				if pool.expired(conn, time.Now()) {
+					pool.close(conn)
+					continue
+				}
+
+				return conn.client, nil
+
+			case pool.slots <- struct{}{}:
+				conn, err := pool.open(ctx)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return conn.client, nil
+
+			case <-timeout:
+				return nil, PaperErrorPoolTimeout
+
+			case <-pool.closed:
+				return nil, PaperErrorClosed
+
+			case <-ctx.Done():
+				return nil, ctx.Err()
+		}
+	}
+}
+
+// Returns a client acquired with Acquire to the pool. If the client has
+// been open for longer than PoolMaxLifetime, it is closed instead, and if
+// its connection failed, it is closed and a replacement is opened in the
+// background.
+func (pool *PaperPool) Release(client *PaperClient) {
+	pool.lock.Lock()
+	conn := pool.conns[client]
+	pool.lock.Unlock()
+
+	if conn == nil {
+		return
+	}
+
+	now := time.Now()
+
+	if pool.isClosed() || pool.expired(conn, now) {
+		pool.close(conn)
+		return
+	}
+
+	if client.isBroken() {
+		pool.evict(conn)
+		return
+	}
+
+	conn.released_at = now
+	pool.idle <- conn
+}
+
+// Acquires a client, calls the supplied function with it and releases it
+// once the function returns, returning the function's error.
+func (pool *PaperPool) Do(ctx context.Context, fn func(*PaperClient) error) error {
+	client, err := pool.Acquire(ctx)
 
-		locked_client := LockableClient {
-			client,
-			lock,
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
+
+	return fn(client)
+}
+
+// Opens a connection using a slot which the caller has already taken,
+// giving the slot back if the connection cannot be opened.
+func (pool *PaperPool) open(ctx context.Context) (*poolConn, error) {
+	client, err := clientConnect(ctx, pool.addr, pool.client_config)
+
+	pool.lock.Lock()
+	auth_token := pool.auth_token
+	pool.lock.Unlock()
+
+	if err == nil && auth_token != nil {
+		err = client.AuthContext(ctx, *auth_token)
+
+		if err != nil {
+			client.Close()
 		}
+	}
 
-		clients = append(clients, &locked_client)
+	if err != nil {
+		<-pool.slots
+		return nil, err
 	}
 
-	index := uint32(0)
+	now := time.Now()
 
-	pool := PaperPool {
-		clients,
-		index,
+	conn := &poolConn {
+		client: client,
+		created_at: now,
+		released_at: now,
 	}
 
-	return &pool, nil
+	pool.lock.Lock()
+	pool.conns[client] = conn
+	pool.lock.Unlock()
+
+	if pool.isClosed() {
+		pool.close(conn)
+		return nil, PaperErrorClosed
+	}
+
+	return conn, nil
 }
 
-func (pool *PaperPool) Disconnect() {
-	for _, lockable_client := range pool.clients {
-		client := lockable_client.Lock()
-		client.Disconnect()
-		lockable_client.Unlock()
+// Closes an idle or released connection for good, so that it does not
+// reconnect once it has left the pool, and gives its slot back.
+func (pool *PaperPool) close(conn *poolConn) {
+	pool.lock.Lock()
+	delete(pool.conns, conn.client)
+	pool.lock.Unlock()
+
+	conn.client.Close()
+	<-pool.slots
+}
+
+// Closes a failed connection and opens a replacement in the background.
+func (pool *PaperPool) evict(conn *poolConn) {
+	pool.config.logf("evicting failed pool connection to %s", pool.addr.host)
+
+	pool.close(conn)
+	go pool.replace()
+}
+
+// Opens a connection to replace one which was evicted, unless the pool
+// has since filled up or been disconnected.
+func (pool *PaperPool) replace() {
+	select {
+		case <-pool.done:
+			return
+
+		case pool.slots <- struct{}{}:
+
+		default:
+			return
+	}
+
+	conn, err := pool.open(context.Background())
+
+	if err != nil {
+		pool.config.logf("could not replace pool connection: %v", err)
+		return
+	}
+
+	select {
+		case <-pool.done:
+			pool.close(conn)
+
+		default:
+			pool.idle <- conn
 	}
 }
 
-func (pool *PaperPool) Auth(token string) () {
-	for _, lockable_client := range pool.clients {
-		client := lockable_client.Lock()
-		client.Auth(token)
-		lockable_client.Unlock()
+func (pool *PaperPool) isClosed() bool {
+	select {
+		case <-pool.closed:
+			return true
+		default:
+			return false
 	}
 }
 
-func (pool *PaperPool) LockableClient() (*LockableClient) {
-	client := pool.clients[pool.index]
+func (pool *PaperPool) expired(conn *poolConn, now time.Time) bool {
+	max_lifetime := pool.config.PoolMaxLifetime
+	return max_lifetime > 0 && now.Sub(conn.created_at) >= max_lifetime
+}
+
+func (pool *PaperPool) clients() []*PaperClient {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	clients := make([]*PaperClient, 0, len(pool.conns))
+
+	for client := range pool.conns {
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+// Gets how often idle connections are checked, which is half of the
+// shorter of PoolIdleTimeout and PoolMaxLifetime, or zero if neither is
+// set.
+func (pool *PaperPool) reapInterval() time.Duration {
+	interval := pool.config.PoolIdleTimeout
+
+	if max_lifetime := pool.config.PoolMaxLifetime; max_lifetime > 0 && (interval == 0 || max_lifetime < interval) {
+		interval = max_lifetime
+	}
+
+	return interval / 2
+}
+
+// Periodically closes idle connections which have been idle for longer
+// than PoolIdleTimeout (while more than the minimum are open) or open for
+// longer than PoolMaxLifetime, then opens connections until the minimum
+// are open again.
+func (pool *PaperPool) reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+			case <-pool.done:
+				return
+
+			case <-ticker.C:
+				pool.reapIdle(time.Now())
+				pool.fill()
+		}
+	}
+}
+
+func (pool *PaperPool) reapIdle(now time.Time) {
+	idle_timeout := pool.config.PoolIdleTimeout
+
+	for i := len(pool.idle); i > 0; i-- {
+		var conn *poolConn
+
+		select {
+			case conn = <-pool.idle:
+			default:
+				return
+		}
+
+		idle_expired := idle_timeout > 0 &&
+			now.Sub(conn.released_at) >= idle_timeout &&
+			uint32(len(pool.slots)) > pool.min_size
+
+		if idle_expired || pool.expired(conn, now) {
+			pool.close(conn)
+			continue
+		}
+
+		pool.idle <- conn
+	}
+}
+
+// Periodically pings idle connections, evicting those which have failed
+// PoolHealthCheckFailures consecutive checks, then opens connections until
+// the minimum are open again.
+func (pool *PaperPool) checkHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+			case <-pool.done:
+				return
+
+			case <-ticker.C:
+				pool.checkIdle(interval)
+				pool.fill()
+		}
+	}
+}
+
+func (pool *PaperPool) checkIdle(interval time.Duration) {
+	max_failures := pool.config.PoolHealthCheckFailures
+
+	if max_failures == 0 {
+		max_failures = 1
+	}
+
+	timeout := pool.config.Timeout
+
+	if timeout == 0 {
+		timeout = interval
+	}
+
+	for i := len(pool.idle); i > 0; i-- {
+		var conn *poolConn
+
+		select {
+			case conn = <-pool.idle:
+			default:
+				return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_, err := conn.client.PingContext(ctx)
+		cancel()
+
+		if err == nil {
+			conn.failures = 0
+		} else if conn.failures++; conn.failures >= max_failures {
+			pool.config.logf("pool connection failed %d health checks: %v", conn.failures, err)
+			pool.evict(conn)
+			continue
+		}
+
+		pool.idle <- conn
+	}
+}
+
+func (pool *PaperPool) fill() {
+	for uint32(len(pool.slots)) < pool.min_size {
+		select {
+			case pool.slots <- struct{}{}:
+			default:
+				return
+		}
+
+		conn, err := pool.open(context.Background())
+
+		if err != nil {
+			pool.config.logf("could not open pool connection: %v", err)
+			return
+		}
+
+		pool.idle <- conn
+	}
+}
+
+// Pings the server using one of the pool's clients.
+func (pool *PaperPool) Ping() (string, error) {
+	return pool.PingContext(context.Background())
+}
+
+// Pings the server using one of the pool's clients within the supplied
+// context.
+func (pool *PaperPool) PingContext(ctx context.Context) (string, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer pool.Release(client)
+
+	return client.PingContext(ctx)
+}
+
+// Gets the cache version using one of the pool's clients.
+func (pool *PaperPool) Version() (string, error) {
+	return pool.VersionContext(context.Background())
+}
+
+// Gets the cache version using one of the pool's clients within the
+// supplied context.
+func (pool *PaperPool) VersionContext(ctx context.Context) (string, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer pool.Release(client)
+
+	return client.VersionContext(ctx)
+}
+
+// Gets the value of the supplied key from the cache using one of the
+// pool's clients.
+func (pool *PaperPool) Get(key string) (string, error) {
+	return pool.GetContext(context.Background(), key)
+}
+
+// Gets the value of the supplied key from the cache using one of the
+// pool's clients within the supplied context.
+func (pool *PaperPool) GetContext(ctx context.Context, key string) (string, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer pool.Release(client)
+
+	return client.GetContext(ctx, key)
+}
+
+// Gets the value of the supplied key from the cache using one of the
+// pool's clients, streaming it to w.
+func (pool *PaperPool) GetTo(key string, w io.Writer) (int64, error) {
+	return pool.GetToContext(context.Background(), key, w)
+}
+
+// Gets the value of the supplied key from the cache using one of the
+// pool's clients, streaming it to w within the supplied context.
+func (pool *PaperPool) GetToContext(ctx context.Context, key string, w io.Writer) (int64, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer pool.Release(client)
+
+	return client.GetToContext(ctx, key, w)
+}
+
+// Sets the supplied key, value, and TTL to the cache using one of the
+// pool's clients.
+func (pool *PaperPool) Set(key string, value string, ttl uint32) error {
+	return pool.SetContext(context.Background(), key, value, ttl)
+}
+
+// Sets the supplied key, value, and TTL to the cache using one of the
+// pool's clients within the supplied context.
+func (pool *PaperPool) SetContext(ctx context.Context, key string, value string, ttl uint32) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
+
+	return client.SetContext(ctx, key, value, ttl)
+}
+
+// Sets the supplied key to size bytes streamed from r with the supplied
+// TTL using one of the pool's clients.
+func (pool *PaperPool) SetFrom(key string, r io.Reader, size uint32, ttl uint32) error {
+	return pool.SetFromContext(context.Background(), key, r, size, ttl)
+}
+
+// Sets the supplied key to size bytes streamed from r with the supplied
+// TTL using one of the pool's clients within the supplied context.
+func (pool *PaperPool) SetFromContext(ctx context.Context, key string, r io.Reader, size uint32, ttl uint32) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
+
+	return client.SetFromContext(ctx, key, r, size, ttl)
+}
+
+// Deletes the value of the supplied key using one of the pool's clients.
+func (pool *PaperPool) Del(key string) error {
+	return pool.DelContext(context.Background(), key)
+}
+
+// Deletes the value of the supplied key using one of the pool's clients
+// within the supplied context.
+func (pool *PaperPool) DelContext(ctx context.Context, key string) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
+
+	return client.DelContext(ctx, key)
+}
+
+// Checks if the cache contains the supplied key using one of the pool's
+// clients.
+func (pool *PaperPool) Has(key string) (bool, error) {
+	return pool.HasContext(context.Background(), key)
+}
+
+// Checks if the cache contains the supplied key using one of the pool's
+// clients within the supplied context.
+func (pool *PaperPool) HasContext(ctx context.Context, key string) (bool, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer pool.Release(client)
+
+	return client.HasContext(ctx, key)
+}
+
+// Gets (peeks) the value of the supplied key from the cache using one of
+// the pool's clients.
+func (pool *PaperPool) Peek(key string) (string, error) {
+	return pool.PeekContext(context.Background(), key)
+}
+
+// Gets (peeks) the value of the supplied key from the cache using one
+// of the pool's clients within the supplied context.
+func (pool *PaperPool) PeekContext(ctx context.Context, key string) (string, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer pool.Release(client)
+
+	return client.PeekContext(ctx, key)
+}
+
+// Sets the TTL of the supplied key using one of the pool's clients.
+func (pool *PaperPool) Ttl(key string, ttl uint32) error {
+	return pool.TtlContext(context.Background(), key, ttl)
+}
+
+// Sets the TTL of the supplied key using one of the pool's clients
+// within the supplied context.
+func (pool *PaperPool) TtlContext(ctx context.Context, key string, ttl uint32) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
 
-	new_index := (pool.index + 1) % uint32(len(pool.clients))
-	atomic.StoreUint32(&pool.index, new_index)
+	return client.TtlContext(ctx, key, ttl)
+}
+
+// Gets the size of the value of the supplied key using one of the pool's
+// clients.
+func (pool *PaperPool) Size(key string) (uint32, error) {
+	return pool.SizeContext(context.Background(), key)
+}
+
+// Gets the size of the value of the supplied key using one of the
+// pool's clients within the supplied context.
+func (pool *PaperPool) SizeContext(ctx context.Context, key string) (uint32, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer pool.Release(client)
+
+	return client.SizeContext(ctx, key)
+}
+
+// Wipes the contents of the cache using one of the pool's clients.
+func (pool *PaperPool) Wipe() error {
+	return pool.WipeContext(context.Background())
+}
+
+// Wipes the contents of the cache using one of the pool's clients
+// within the supplied context.
+func (pool *PaperPool) WipeContext(ctx context.Context) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
+
+	return client.WipeContext(ctx)
+}
+
+// Resizes the cache using one of the pool's clients.
+func (pool *PaperPool) Resize(size uint64) error {
+	return pool.ResizeContext(context.Background(), size)
+}
+
+// Resizes the cache using one of the pool's clients within the supplied
+// context.
+func (pool *PaperPool) ResizeContext(ctx context.Context, size uint64) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
 
-	return client
+	return client.ResizeContext(ctx, size)
 }
 
+// Sets the cache's eviction policy using one of the pool's clients.
+func (pool *PaperPool) Policy(policy string) error {
+	return pool.PolicyContext(context.Background(), policy)
+}
+
+// Sets the cache's eviction policy using one of the pool's clients
+// within the supplied context.
+func (pool *PaperPool) PolicyContext(ctx context.Context, policy string) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
+
+	return client.PolicyContext(ctx, policy)
+}
+
+// Gets the cache's status using one of the pool's clients.
+func (pool *PaperPool) Status() (*PaperStatus, error) {
+	return pool.StatusContext(context.Background())
+}
+
+// Gets the cache's status using one of the pool's clients within the
+// supplied context.
+func (pool *PaperPool) StatusContext(ctx context.Context) (*PaperStatus, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer pool.Release(client)
+
+	return client.StatusContext(ctx)
+}
+
+// Gets the value of the supplied key from the cache as bytes using one of
+// the pool's clients.
+func (pool *PaperPool) GetBytes(key string) ([]byte, error) {
+	return pool.GetBytesContext(context.Background(), key)
+}
+
+// Gets the value of the supplied key from the cache as bytes using one of
+// the pool's clients within the supplied context.
+func (pool *PaperPool) GetBytesContext(ctx context.Context, key string) ([]byte, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer pool.Release(client)
+
+	return client.GetBytesContext(ctx, key)
+}
+
+// Gets the value of the supplied key from the cache using one of the
+// pool's clients, appending it to dst and returning the extended slice.
+func (pool *PaperPool) GetInto(key string, dst []byte) ([]byte, error) {
+	return pool.GetIntoContext(context.Background(), key, dst)
+}
+
+// Gets the value of the supplied key from the cache using one of the
+// pool's clients, appending it to dst within the supplied context.
+func (pool *PaperPool) GetIntoContext(ctx context.Context, key string, dst []byte) ([]byte, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return dst, err
+	}
+
+	defer pool.Release(client)
+
+	return client.GetIntoContext(ctx, key, dst)
+}
+
+// Sets the supplied key, value as bytes, and TTL to the cache using one
+// of the pool's clients.
+func (pool *PaperPool) SetBytes(key string, value []byte, ttl uint32) error {
+	return pool.SetBytesContext(context.Background(), key, value, ttl)
+}
+
+// Sets the supplied key, value as bytes, and TTL to the cache using one
+// of the pool's clients within the supplied context.
+func (pool *PaperPool) SetBytesContext(ctx context.Context, key string, value []byte, ttl uint32) error {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Release(client)
+
+	return client.SetBytesContext(ctx, key, value, ttl)
+}
+
+// Gets (peeks) the value of the supplied key from the cache as bytes
+// using one of the pool's clients.
+func (pool *PaperPool) PeekBytes(key string) ([]byte, error) {
+	return pool.PeekBytesContext(context.Background(), key)
+}
+
+// Gets (peeks) the value of the supplied key from the cache as bytes
+// using one of the pool's clients within the supplied context.
+func (pool *PaperPool) PeekBytesContext(ctx context.Context, key string) ([]byte, error) {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer pool.Release(client)
+
+	return client.PeekBytesContext(ctx, key)
+}
+
+// Gets a handle which acquires one of the pool's clients when locked.
+//
+// Deprecated: use PaperPool.Acquire and PaperPool.Release, or PaperPool.Do.
+func (pool *PaperPool) LockableClient() (*LockableClient) {
+	return &LockableClient {
+		pool: pool,
+	}
+}
+
+// Acquires one of the pool's clients, waiting until the handle is unlocked
+// and one of the clients is idle. If a new connection cannot be opened,
+// acquiring is retried after the configured backoff. Once the pool is
+// closed, a closed client is returned, whose commands fail with
+// PaperErrorClosed.
 func (lockable_client *LockableClient) Lock() (*PaperClient) {
 	lockable_client.lock.Lock()
-	return lockable_client.client
+
+	pool := lockable_client.pool
+
+	for attempt := uint32(1); ; attempt++ {
+		client, err := pool.Acquire(context.Background())
+
+		if err == PaperErrorClosed {
+			client = closedClient(pool.addr, pool.client_config)
+		}
+
+		if client != nil {
+			lockable_client.client = client
+			return client
+		}
+
+		pool.config.logf("could not lock pool client (attempt %d): %v", attempt, err)
+		time.Sleep(pool.lockBackoff(attempt))
+	}
 }
 
+// Releases the client acquired by Lock and unlocks the handle.
 func (lockable_client *LockableClient) Unlock() {
+	client := lockable_client.client
+	lockable_client.client = nil
+
 	lockable_client.lock.Unlock()
+
+	lockable_client.pool.Release(client)
+}
+
+// Gets the delay before Lock tries to acquire a client again, which is the
+// configured backoff or, if there is none, the default backoff.
+func (pool *PaperPool) lockBackoff(attempt uint32) time.Duration {
+	if backoff := pool.config.Backoff; backoff != nil {
+		return backoff(attempt)
+	}
+
+	return ExponentialBackoff(DefaultBackoffInitial, DefaultBackoffMax)(attempt)
 }
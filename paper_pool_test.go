@@ -8,7 +8,11 @@
 package paperclient
 
 import (
+	"net"
+	"sync"
+	"context"
 	"testing"
+	"time"
 )
 
 func TestClient(t *testing.T) {
@@ -33,6 +37,83 @@ func TestClient(t *testing.T) {
 	}
 }
 
+func TestLockableClientShared(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	lockable_client := pool.LockableClient()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			client := lockable_client.Lock()
+			defer lockable_client.Unlock()
+
+			if _, err := client.Ping(); err != nil {
+				t.Error("shared pool client ping returned an error")
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(pool.idle) != len(pool.slots) {
+		t.Error("shared lockable client did not release every client")
+	}
+}
+
+func TestLockableClientExclusive(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	lockable_client := pool.LockableClient()
+	lockable_client.Lock()
+
+	locked := make(chan struct{})
+
+	go func() {
+		lockable_client.Lock()
+		close(locked)
+		lockable_client.Unlock()
+	}()
+
+	select {
+		case <-locked:
+			t.Error("shared lockable client was locked twice at once")
+
+		case <-time.After(20 * time.Millisecond):
+	}
+
+	lockable_client.Unlock()
+
+	select {
+		case <-locked:
+
+		case <-time.After(time.Second):
+			t.Error("shared lockable client was not locked after being unlocked")
+	}
+}
+
+func TestLockableClientClosed(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	pool.Close()
+
+	lockable_client := pool.LockableClient()
+
+	client := lockable_client.Lock()
+
+	if _, err := client.Ping(); err != PaperErrorClosed {
+		t.Errorf("lockable client of closed pool returned %v instead of PaperErrorClosed", err)
+	}
+
+	lockable_client.Unlock()
+}
+
 func TestAuthInvalid(t *testing.T) {
 	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
 	defer pool.Disconnect()
@@ -66,3 +147,411 @@ func TestAuthValid(t *testing.T) {
 
 	lockable_client.Unlock()
 }
+
+func TestPoolUnixSocket(t *testing.T) {
+	path := initUnixServer(t)
+
+	pool, err := PoolConnect("paper+unix://" + path, 2)
+
+	if err != nil {
+		t.Fatal("could not connect pool over a unix socket")
+	}
+
+	defer pool.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		lockable_client := pool.LockableClient()
+
+		client := lockable_client.Lock()
+		client.Disconnect()
+		response, err := client.Ping()
+
+		if err != nil {
+			t.Error("pool client ping returned an error after reconnecting over a unix socket")
+		}
+
+		if response != "pong" {
+			t.Error("pool client ping did not return pong after reconnecting over a unix socket")
+		}
+
+		lockable_client.Unlock()
+	}
+}
+
+func TestPoolBytes(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+
+	err := pool.SetBytes("key", []byte("value"), 0)
+
+	if err != nil {
+		t.Error("pool set bytes returned an error")
+	}
+
+	for i := 0; i < 2; i++ {
+		response, err := pool.GetBytes("key")
+
+		if err != nil {
+			t.Error("pool get bytes returned an error for a key which exists")
+		}
+
+		if string(response) != "value" {
+			t.Errorf("pool get bytes returned %q instead of \"value\"", response)
+		}
+	}
+}
+
+func TestPoolAcquire(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	first, err := pool.Acquire(context.Background())
+
+	if err != nil {
+		t.Fatal("pool acquire returned an error")
+	}
+
+	second, err := pool.Acquire(context.Background())
+
+	if err != nil {
+		t.Fatal("pool acquire returned an error while a client was idle")
+	}
+
+	if first == second {
+		t.Error("pool acquire returned a client which was already acquired")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+
+	if _, err := pool.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("pool acquire returned %v instead of context.DeadlineExceeded while every client was in use", err)
+	}
+
+	acquired := make(chan *PaperClient)
+
+	go func() {
+		client, _ := pool.Acquire(context.Background())
+		acquired <- client
+	}()
+
+	pool.Release(first)
+
+	if client := <-acquired; client != first {
+		t.Error("waiting pool acquire did not return the released client")
+	}
+
+	pool.Release(first)
+	pool.Release(second)
+}
+
+func TestPoolTimeout(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 1, WithPoolTimeout(20 * time.Millisecond))
+	defer pool.Disconnect()
+
+	client, _ := pool.Acquire(context.Background())
+	defer pool.Release(client)
+
+	if _, err := pool.Acquire(context.Background()); err != PaperErrorPoolTimeout {
+		t.Errorf("pool acquire returned %v instead of PaperErrorPoolTimeout", err)
+	}
+}
+
+func TestPoolDo(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 1)
+	defer pool.Disconnect()
+
+	err := pool.Do(context.Background(), func(client *PaperClient) error {
+		response, err := client.Ping()
+
+		if response != "pong" {
+			t.Error("pool client ping did not return pong")
+		}
+
+		return err
+	})
+
+	if err != nil {
+		t.Error("pool do returned an error")
+	}
+
+	// the client must have been released
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := pool.Do(ctx, func(*PaperClient) error { return nil }); err != nil {
+		t.Error("pool do did not release its client")
+	}
+}
+
+func TestPoolCommands(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+
+	if response, err := pool.Ping(); err != nil || response != "pong" {
+		t.Error("pool ping did not return pong")
+	}
+
+	if err := pool.Set("pool_key", "value", 0); err != nil {
+		t.Error("pool set returned an error")
+	}
+
+	if response, err := pool.Get("pool_key"); err != nil || response != "value" {
+		t.Errorf("pool get returned %q instead of \"value\"", response)
+	}
+
+	if response, err := pool.Peek("pool_key"); err != nil || response != "value" {
+		t.Errorf("pool peek returned %q instead of \"value\"", response)
+	}
+
+	if has, err := pool.Has("pool_key"); err != nil || !has {
+		t.Error("pool has returned false for a key which exists")
+	}
+
+	if err := pool.Ttl("pool_key", 5); err != nil {
+		t.Error("pool ttl returned an error")
+	}
+
+	if err := pool.Del("pool_key"); err != nil {
+		t.Error("pool del returned an error")
+	}
+
+	if _, err := pool.Get("pool_key"); err != PaperErrorKeyNotFound {
+		t.Error("pool get did not return PaperErrorKeyNotFound after del")
+	}
+
+	if _, err := pool.Status(); err != nil {
+		t.Error("pool status returned an error")
+	}
+}
+
+func TestPoolGrows(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 3, WithPoolMinSize(1), WithPoolTimeout(20 * time.Millisecond))
+	defer pool.Disconnect()
+
+	if len(pool.clients()) != 1 {
+		t.Errorf("pool opened %d connections up front instead of 1", len(pool.clients()))
+	}
+
+	clients := []*PaperClient{}
+
+	for i := 0; i < 3; i++ {
+		client, err := pool.Acquire(context.Background())
+
+		if err != nil {
+			t.Fatal("pool acquire returned an error while the pool could grow")
+		}
+
+		clients = append(clients, client)
+	}
+
+	if len(pool.clients()) != 3 {
+		t.Errorf("pool grew to %d connections instead of 3", len(pool.clients()))
+	}
+
+	if _, err := pool.Acquire(context.Background()); err != PaperErrorPoolTimeout {
+		t.Error("pool grew beyond its size")
+	}
+
+	for _, client := range clients {
+		pool.Release(client)
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	pool, _ := PoolConnect(
+		"paper://127.0.0.1:3145",
+		3,
+		WithPoolMinSize(1),
+		WithPoolIdleTimeout(20 * time.Millisecond),
+	)
+
+	defer pool.Disconnect()
+
+	clients := []*PaperClient{}
+
+	for i := 0; i < 3; i++ {
+		client, _ := pool.Acquire(context.Background())
+		clients = append(clients, client)
+	}
+
+	for _, client := range clients {
+		pool.Release(client)
+	}
+
+	for i := 0; i < 100 && len(pool.clients()) > 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(pool.clients()) != 1 {
+		t.Errorf("pool kept %d idle connections open instead of 1", len(pool.clients()))
+	}
+
+	if response, err := pool.Ping(); err != nil || response != "pong" {
+		t.Error("pool ping did not return pong after closing idle connections")
+	}
+}
+
+func TestPoolMaxLifetime(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 1, WithPoolMaxLifetime(20 * time.Millisecond))
+	defer pool.Disconnect()
+
+	first, _ := pool.Acquire(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	pool.Release(first)
+
+	second, err := pool.Acquire(context.Background())
+
+	if err != nil {
+		t.Fatal("pool acquire returned an error after recycling a connection")
+	}
+
+	defer pool.Release(second)
+
+	if first == second {
+		t.Error("pool did not recycle a connection which exceeded its lifetime")
+	}
+
+	if response, err := second.Ping(); err != nil || response != "pong" {
+		t.Error("recycled pool client ping did not return pong")
+	}
+}
+
+func TestPoolConnectPartialFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal("could not start server")
+	}
+
+	defer listener.Close()
+
+	closed := make(chan struct{})
+
+	go func() {
+		// the first connection is served, and every later one is refused
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go func() {
+			serveStalled(conn)
+			close(closed)
+		}()
+
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			conn.Close()
+		}
+	}()
+
+	_, err = PoolConnect("paper://" + listener.Addr().String(), 2, WithPoolMinSize(2))
+
+	if err == nil {
+		t.Fatal("pool connect did not return an error when a connection was refused")
+	}
+
+	select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Error("pool connect did not close the connection it opened before failing")
+	}
+}
+
+func TestPoolEvictsBrokenClient(t *testing.T) {
+	pool, err := PoolConnect(initStalledServer(t), 1)
+
+	if err != nil {
+		t.Fatal("could not connect pool")
+	}
+
+	defer pool.Disconnect()
+
+	client, _ := pool.Acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+
+	if _, err := client.PingContext(ctx); err == nil {
+		t.Fatal("ping on a stalled server did not return an error")
+	}
+
+	pool.Release(client)
+
+	if !waitForReplacement(pool, client) {
+		t.Error("pool did not replace a client whose connection failed")
+	}
+}
+
+func TestPoolClosesEvictedClient(t *testing.T) {
+	pool, err := PoolConnect(initStalledServer(t), 1, WithBackgroundReconnect())
+
+	if err != nil {
+		t.Fatal("could not connect pool")
+	}
+
+	defer pool.Close()
+
+	client, _ := pool.Acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+
+	client.PingContext(ctx)
+	pool.Release(client)
+
+	if !waitForReplacement(pool, client) {
+		t.Fatal("pool did not replace a client whose connection failed")
+	}
+
+	if state := client.State(); state != StateClosed {
+		t.Errorf("evicted client was %v instead of closed", state)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	pool, err := PoolConnect(
+		initStalledServer(t),
+		1,
+		WithTimeout(20 * time.Millisecond),
+		WithPoolHealthCheck(10 * time.Millisecond, 1),
+	)
+
+	if err != nil {
+		t.Fatal("could not connect pool")
+	}
+
+	defer pool.Disconnect()
+
+	client := pool.clients()[0]
+
+	if !waitForReplacement(pool, client) {
+		t.Error("pool did not replace a client which failed its health check")
+	}
+}
+
+// Waits for the pool to hold one client other than the supplied one.
+func waitForReplacement(pool *PaperPool, client *PaperClient) bool {
+	for i := 0; i < 100; i++ {
+		clients := pool.clients()
+
+		if len(clients) == 1 && clients[0] != client {
+			return true
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
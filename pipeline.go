@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"context"
+)
+
+// Queues commands to be sent to the server in a single batch, with their
+// responses read back afterwards, so that many commands cost one round
+// trip. A Pipeline is not safe for concurrent use.
+type Pipeline struct {
+	exec func(ctx context.Context, commands []pipelineCommand) []PipelineResult
+	commands []pipelineCommand
+}
+
+// The result of a pipelined command. Value holds what the equivalent
+// PaperClient method would have returned (a string for Get, a bool for
+// Has, a *PaperStatus for Status, etc.), or nil for commands which only
+// return an error.
+type PipelineResult struct {
+	Value interface{}
+	Err error
+}
+
+type pipelineCommand struct {
+	writer *sheetWriter
+	read func(*sheetReader) (interface{}, error)
+}
+
+// Creates a pipeline which is executed on the client's connection.
+func (client *PaperClient) Pipeline() *Pipeline {
+	return &Pipeline {
+		exec: client.execPipeline,
+	}
+}
+
+// Creates a pipeline which is executed on one of the pool's clients.
+func (pool *PaperPool) Pipeline() *Pipeline {
+	return &Pipeline {
+		exec: pool.execPipeline,
+	}
+}
+
+// Sends the queued commands and reads their responses, returning one
+// result per command in the order they were queued. The pipeline is then
+// empty and can be reused.
+func (pipeline *Pipeline) Exec() []PipelineResult {
+	return pipeline.ExecContext(context.Background())
+}
+
+// Sends the queued commands and reads their responses within the supplied
+// context.
+func (pipeline *Pipeline) ExecContext(ctx context.Context) []PipelineResult {
+	commands := pipeline.commands
+	pipeline.commands = nil
+
+	if len(commands) == 0 {
+		return nil
+	}
+
+	return pipeline.exec(ctx, commands)
+}
+
+// Gets the number of queued commands.
+func (pipeline *Pipeline) Len() int {
+	return len(pipeline.commands)
+}
+
+// Queues a ping.
+func (pipeline *Pipeline) Ping() {
+	pipeline.queue(pingWriter(), readStringValue)
+}
+
+// Queues getting the cache version.
+func (pipeline *Pipeline) Version() {
+	pipeline.queue(versionWriter(), readStringValue)
+}
+
+// Queues getting the value of the supplied key as a string.
+func (pipeline *Pipeline) Get(key string) {
+	pipeline.queue(getWriter(key), readStringValue)
+}
+
+// Queues getting the value of the supplied key as bytes.
+func (pipeline *Pipeline) GetBytes(key string) {
+	pipeline.queue(getWriter(key), readBytesValue)
+}
+
+// Queues setting the supplied key, value, and TTL.
+func (pipeline *Pipeline) Set(key string, value string, ttl uint32) {
+	pipeline.queue(setWriter(key, value, ttl), nil)
+}
+
+// Queues setting the supplied key, value as bytes, and TTL.
+func (pipeline *Pipeline) SetBytes(key string, value []byte, ttl uint32) {
+	pipeline.queue(setBytesWriter(key, value, ttl), nil)
+}
+
+// Queues deleting the value of the supplied key.
+func (pipeline *Pipeline) Del(key string) {
+	pipeline.queue(delWriter(key), nil)
+}
+
+// Queues checking if the cache contains the supplied key.
+func (pipeline *Pipeline) Has(key string) {
+	pipeline.queue(hasWriter(key), readBoolValue)
+}
+
+// Queues peeking the value of the supplied key as a string.
+func (pipeline *Pipeline) Peek(key string) {
+	pipeline.queue(peekWriter(key), readStringValue)
+}
+
+// Queues peeking the value of the supplied key as bytes.
+func (pipeline *Pipeline) PeekBytes(key string) {
+	pipeline.queue(peekWriter(key), readBytesValue)
+}
+
+// Queues setting the TTL of the supplied key.
+func (pipeline *Pipeline) Ttl(key string, ttl uint32) {
+	pipeline.queue(ttlWriter(key, ttl), nil)
+}
+
+// Queues getting the size of the value of the supplied key.
+func (pipeline *Pipeline) Size(key string) {
+	pipeline.queue(sizeWriter(key), readSizeValue)
+}
+
+// Queues wiping the contents of the cache.
+func (pipeline *Pipeline) Wipe() {
+	pipeline.queue(wipeWriter(), nil)
+}
+
+// Queues resizing the cache.
+func (pipeline *Pipeline) Resize(size uint64) {
+	pipeline.queue(resizeWriter(size), nil)
+}
+
+// Queues setting the cache's eviction policy.
+func (pipeline *Pipeline) Policy(policy string) {
+	pipeline.queue(policyWriter(policy), nil)
+}
+
+// Queues getting the cache's status.
+func (pipeline *Pipeline) Status() {
+	pipeline.queue(statusWriter(), readStatusValue)
+}
+
+func (pipeline *Pipeline) queue(writer *sheetWriter, read func(*sheetReader) (interface{}, error)) {
+	pipeline.commands = append(pipeline.commands, pipelineCommand {
+		writer,
+		read,
+	})
+}
+
+// Sends every command in one write and reads the responses in order. A
+// command the server rejects only fails its own result, but an I/O error
+// fails every command whose response was not yet read.
+func (client *PaperClient) execPipeline(ctx context.Context, commands []pipelineCommand) []PipelineResult {
+	results := make([]PipelineResult, len(commands))
+	received := 0
+
+	batch := initSheetWriter()
+
+	for _, command := range commands {
+		batch.writeSheet(command.writer)
+	}
+
+	// the results of the commands read so far would be lost
+	batch.disableRetry()
+
+	ctx, cancel := withTimeout(ctx, client.config.Timeout)
+	defer cancel()
+
+	err := client.acquire(ctx)
+
+	if err == nil {
+		err = client.run(ctx, "pipeline", batch, func(reader *sheetReader) error {
+			for received < len(commands) {
+				result := &results[received]
+				read := commands[received].read
+
+				result.Err = readResponse(reader, func(reader *sheetReader) error {
+					if read == nil {
+						return nil
+					}
+
+					var err error
+					result.Value, err = read(reader)
+
+					return err
+				})
+
+				if result.Err != nil && reader.tcp_client.isBroken() {
+					return result.Err
+				}
+
+				received++
+			}
+
+			return nil
+		})
+
+		client.release()
+	}
+
+	if err != nil {
+		for i := received; i < len(commands); i++ {
+			results[i] = PipelineResult { nil, err }
+		}
+	}
+
+	return results
+}
+
+func (pool *PaperPool) execPipeline(ctx context.Context, commands []pipelineCommand) []PipelineResult {
+	client, err := pool.Acquire(ctx)
+
+	if err != nil {
+		results := make([]PipelineResult, len(commands))
+
+		for i := range results {
+			results[i] = PipelineResult { nil, err }
+		}
+
+		return results
+	}
+
+	defer pool.Release(client)
+
+	return client.execPipeline(ctx, commands)
+}
+
+func readStringValue(reader *sheetReader) (interface{}, error) {
+	return reader.readString()
+}
+
+func readBytesValue(reader *sheetReader) (interface{}, error) {
+	return reader.readBytes()
+}
+
+func readBoolValue(reader *sheetReader) (interface{}, error) {
+	return reader.readBool()
+}
+
+func readSizeValue(reader *sheetReader) (interface{}, error) {
+	return reader.readU32()
+}
+
+func readStatusValue(reader *sheetReader) (interface{}, error) {
+	return statusFromReader(reader)
+}
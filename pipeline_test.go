@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	pipeline := client.Pipeline()
+
+	pipeline.Set("key", "value", 0)
+	pipeline.Get("key")
+	pipeline.Get("pipeline_missing_key")
+	pipeline.Has("key")
+	pipeline.GetBytes("key")
+
+	if pipeline.Len() != 5 {
+		t.Errorf("pipeline has %d queued commands instead of 5", pipeline.Len())
+	}
+
+	results := pipeline.Exec()
+
+	if len(results) != 5 {
+		t.Fatalf("pipeline returned %d results instead of 5", len(results))
+	}
+
+	if results[0].Err != nil {
+		t.Error("pipelined set returned an error")
+	}
+
+	if results[1].Err != nil || results[1].Value != "value" {
+		t.Errorf("pipelined get returned %v, %v instead of \"value\"", results[1].Value, results[1].Err)
+	}
+
+	if results[2].Err == nil {
+		t.Error("pipelined get did not return an error for a key which does not exist")
+	}
+
+	if results[3].Err != nil || results[3].Value != true {
+		t.Error("pipelined has did not return true for a key which exists")
+	}
+
+	if value, ok := results[4].Value.([]byte); !ok || string(value) != "value" {
+		t.Error("pipelined get bytes did not return \"value\"")
+	}
+
+	if pipeline.Len() != 0 {
+		t.Error("pipeline was not empty after exec")
+	}
+
+	response, err := client.Ping()
+
+	if err != nil || response != "pong" {
+		t.Error("client ping failed after a pipeline")
+	}
+}
+
+func TestPipelineEmpty(t *testing.T) {
+	client := initClient(t, true)
+	defer client.Disconnect()
+
+	if results := client.Pipeline().Exec(); results != nil {
+		t.Error("empty pipeline returned results")
+	}
+}
+
+func TestPipelineContextDeadline(t *testing.T) {
+	client := initStalledClient(t)
+	defer client.Disconnect()
+
+	pipeline := client.Pipeline()
+	pipeline.Ping()
+	pipeline.Ping()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	for i, result := range pipeline.ExecContext(ctx) {
+		if result.Err != context.DeadlineExceeded {
+			t.Errorf("pipelined command %d returned %v instead of context.DeadlineExceeded", i, result.Err)
+		}
+	}
+}
+
+func TestPoolPipeline(t *testing.T) {
+	pool, _ := PoolConnect("paper://127.0.0.1:3145", 2)
+	defer pool.Disconnect()
+
+	pool.Auth("auth_token")
+
+	pipeline := pool.Pipeline()
+	pipeline.Set("key", "value", 0)
+	pipeline.Get("key")
+
+	results := pipeline.Exec()
+
+	if results[0].Err != nil {
+		t.Error("pool pipelined set returned an error")
+	}
+
+	if results[1].Value != "value" {
+		t.Errorf("pool pipelined get returned %v instead of \"value\"", results[1].Value)
+	}
+}
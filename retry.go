@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"time"
+)
+
+// Decides whether a command is retried after a transient network error,
+// e.g. the connection being reset after the command was sent. Commands
+// the server rejected, or whose context is done, are never retried.
+type RetryPolicy interface {
+	// Gets whether the named command (e.g. "get") is retried after the
+	// supplied attempt (starting at 1) failed with the supplied error,
+	// and how long to wait before retrying it.
+	ShouldRetry(command string, attempt uint32, err error) (bool, time.Duration)
+}
+
+// Retries idempotent commands, which have the same effect if the server
+// runs them twice, up to MaxRetries times. These are ping, version, get,
+// peek, has, size, status, set and del.
+type IdempotentRetryPolicy struct {
+	MaxRetries uint32
+
+	// Gets the delay before each retry. If nil, commands are retried
+	// immediately.
+	Backoff BackoffFunc
+
+	// Further commands to retry (e.g. "wipe"). Commands which are not
+	// idempotent, such as wipe, resize and policy, are only retried if
+	// they are listed here.
+	AllowCommands []string
+}
+
+const DefaultMaxRetries uint32 = 2
+
+var idempotentCommands = map[string]bool {
+	"ping": true,
+	"version": true,
+
+	"get": true,
+	"peek": true,
+	"has": true,
+	"size": true,
+	"status": true,
+
+	"set": true,
+	"del": true,
+}
+
+func (policy *IdempotentRetryPolicy) ShouldRetry(command string, attempt uint32, err error) (bool, time.Duration) {
+	if attempt > policy.MaxRetries || !policy.allows(command) {
+		return false, 0
+	}
+
+	if policy.Backoff == nil {
+		return true, 0
+	}
+
+	return true, policy.Backoff(attempt)
+}
+
+func (policy *IdempotentRetryPolicy) allows(command string) bool {
+	if idempotentCommands[command] {
+		return true
+	}
+
+	for _, allowed := range policy.AllowCommands {
+		if allowed == command {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func TestRetryIdempotent(t *testing.T) {
+	response := initSheetWriter()
+	response.writeU8('!')
+	response.writeString("value")
+
+	client, err := ClientConnect(initFlakyServer(t, response.getBuf()))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	value, err := client.Get("key")
+
+	if err != nil || value != "value" {
+		t.Errorf("get returned %q, %v instead of being retried after the connection was reset", value, err)
+	}
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	response := initSheetWriter()
+	response.writeU8('!')
+
+	client, err := ClientConnect(initFlakyServer(t, response.getBuf()))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	if err := client.Wipe(); err == nil {
+		t.Error("wipe was retried after the connection was reset")
+	}
+}
+
+func TestRetryAllowCommands(t *testing.T) {
+	response := initSheetWriter()
+	response.writeU8('!')
+
+	client, err := ClientConnect(
+		initFlakyServer(t, response.getBuf()),
+		WithRetryPolicy(&IdempotentRetryPolicy {
+			MaxRetries: 1,
+			AllowCommands: []string { "wipe" },
+		}),
+	)
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	if err := client.Wipe(); err != nil {
+		t.Errorf("allowed wipe returned %v instead of being retried", err)
+	}
+}
+
+func TestRetryDisabled(t *testing.T) {
+	response := initSheetWriter()
+	response.writeU8('!')
+	response.writeString("value")
+
+	client, err := ClientConnect(initFlakyServer(t, response.getBuf()), WithRetryPolicy(nil))
+
+	if err != nil {
+		t.Fatal("Could not connect client")
+	}
+
+	defer client.Close()
+
+	if _, err := client.Get("key"); err == nil {
+		t.Error("get was retried without a retry policy")
+	}
+}
+
+func TestIdempotentRetryPolicy(t *testing.T) {
+	policy := &IdempotentRetryPolicy {
+		MaxRetries: 2,
+		Backoff: ConstantBackoff(5),
+	}
+
+	for _, command := range []string { "get", "peek", "has", "size", "status", "set", "del" } {
+		if retry, delay := policy.ShouldRetry(command, 1, io.EOF); !retry || delay != 5 {
+			t.Errorf("idempotent command %s was not retried", command)
+		}
+	}
+
+	for _, command := range []string { "wipe", "resize", "policy", "ttl", "pipeline" } {
+		if retry, _ := policy.ShouldRetry(command, 1, io.EOF); retry {
+			t.Errorf("command %s was retried", command)
+		}
+	}
+
+	if retry, _ := policy.ShouldRetry("get", 3, io.EOF); retry {
+		t.Error("command was retried beyond the maximum number of retries")
+	}
+}
+
+// Starts a server which answers the ping on the first connection and then
+// resets it once the next command arrives. Every later connection answers
+// its first command with the supplied response.
+func initFlakyServer(t *testing.T, response []byte) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal("Could not start flaky server")
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			pong := initSheetWriter()
+			pong.writeU8('!')
+			pong.writeString("pong")
+
+			command := make([]byte, 1)
+
+			if _, err := conn.Read(command); err != nil {
+				return
+			}
+
+			conn.Write(pong.getBuf())
+			conn.Read(command)
+		}()
+
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				command := make([]byte, 1)
+
+				if _, err := conn.Read(command); err != nil {
+					return
+				}
+
+				conn.Write(response)
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	return "paper://" + listener.Addr().String()
+}
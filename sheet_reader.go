@@ -8,34 +8,66 @@
 package paperclient
 
 import (
+	"io"
 	"math"
+	"bufio"
+	"strings"
 	"encoding/binary"
 )
 
+// Reads responses from a connection. Each connection has a single reader
+// whose buffers are reused for every response, and every field is read in
+// full, so a response split across several reads is never misparsed.
 type sheetReader struct {
 	tcp_client *tcpClient
+	reader *bufio.Reader
+
+	// Scratch space for fixed-width fields.
+	buf [8]byte
+
+	max_response_size uint64
+	max_value_size uint32
+	max_policies uint32
+
+	// The number of bytes of the current response read so far.
+	response_size uint64
 }
 
-func initSheetReader(tcp_client *tcpClient) *sheetReader {
+func initSheetReader(tcp_client *tcpClient, config *Config) *sheetReader {
 	return &sheetReader {
-		tcp_client,
+		tcp_client: tcp_client,
+		reader: bufio.NewReader(tcp_client.getConn()),
+
+		max_response_size: config.MaxResponseSize,
+		max_value_size: config.MaxValueSize,
+		max_policies: config.MaxPolicies,
 	}
 }
 
+// Resets the size limit and applies the read timeout for the next
+// response.
+func (sheet *sheetReader) startResponse() {
+	sheet.response_size = 0
+	sheet.tcp_client.startRead()
+}
+
 func (sheet *sheetReader) readU8() (uint8, error) {
-	data := make([]byte, 1)
-	_, err := sheet.tcp_client.getConn().Read(data)
+	if err := sheet.consume(1); err != nil {
+		return 0, err
+	}
+
+	data, err := sheet.reader.ReadByte()
 
 	if err != nil {
+		sheet.fail()
 		return 0, err
 	}
 
-	return data[0], nil
+	return data, nil
 }
 
 func (sheet *sheetReader) readU32() (uint32, error) {
-	data := make([]byte, 4)
-	_, err := sheet.tcp_client.getConn().Read(data)
+	data, err := sheet.read(4)
 
 	if err != nil {
 		return 0, err
@@ -45,8 +77,7 @@ func (sheet *sheetReader) readU32() (uint32, error) {
 }
 
 func (sheet *sheetReader) readU64() (uint64, error) {
-	data := make([]byte, 8)
-	_, err := sheet.tcp_client.getConn().Read(data)
+	data, err := sheet.read(8)
 
 	if err != nil {
 		return 0, err
@@ -56,14 +87,12 @@ func (sheet *sheetReader) readU64() (uint64, error) {
 }
 
 func (sheet *sheetReader) readF64() (float64, error) {
-	data := make([]byte, 8)
-	_, err := sheet.tcp_client.getConn().Read(data)
+	bits, err := sheet.readU64()
 
 	if err != nil {
 		return 0, err
 	}
 
-	bits := binary.LittleEndian.Uint64(data)
 	return math.Float64frombits(bits), nil
 }
 
@@ -78,18 +107,178 @@ func (sheet *sheetReader) readBool() (bool, error) {
 }
 
 func (sheet *sheetReader) readString() (string, error) {
-	length, err := sheet.readU32()
+	length, err := sheet.readLength()
 
 	if err != nil {
 		return "", err
 	}
 
-	data := make([]byte, length)
-	_, err = sheet.tcp_client.getConn().Read(data)
+	var builder strings.Builder
+	builder.Grow(int(length))
 
-	if err != nil {
+	if _, err := sheet.copyN(&builder, length); err != nil {
 		return "", err
 	}
 
-	return string(data), nil
+	return builder.String(), nil
+}
+
+// Reads a length-prefixed value, copying it to the supplied writer. The
+// value is not subject to the value and response limits since it is not
+// held in memory.
+func (sheet *sheetReader) readStream(writer io.Writer) (int64, error) {
+	length, err := sheet.readU32()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return sheet.copyN(writer, length)
+}
+
+func (sheet *sheetReader) readBytes() ([]byte, error) {
+	return sheet.appendBytes(nil)
+}
+
+// Reads a length-prefixed value, appending it to the supplied slice and
+// returning the extended slice. The slice's spare capacity is used if
+// there is enough of it.
+func (sheet *sheetReader) appendBytes(dst []byte) ([]byte, error) {
+	length, err := sheet.readLength()
+
+	if err != nil {
+		return dst, err
+	}
+
+	start := len(dst)
+	end := start + int(length)
+
+	if end > cap(dst) {
+		grown := make([]byte, start, end)
+		copy(grown, dst)
+		dst = grown
+	}
+
+	if _, err := io.ReadFull(sheet.reader, dst[start:end]); err != nil {
+		sheet.fail()
+		return dst[:start], unexpectedEOF(err)
+	}
+
+	return dst[:end], nil
+}
+
+// Reads the length prefix of a value, checking it against the limits.
+func (sheet *sheetReader) readLength() (uint32, error) {
+	length, err := sheet.readU32()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if sheet.max_value_size != 0 && length > sheet.max_value_size {
+		return 0, sheet.reject()
+	}
+
+	if err := sheet.consume(uint64(length)); err != nil {
+		return 0, err
+	}
+
+	return length, nil
+}
+
+// Copies exactly n bytes to the writer straight out of the reader's
+// buffer, without allocating an intermediate one, and returns the number
+// of bytes written. If the writer fails, the rest of the bytes are still
+// read and discarded so the connection is left at the end of the value.
+func (sheet *sheetReader) copyN(writer io.Writer, n uint32) (int64, error) {
+	remaining := int(n)
+
+	var written int64
+	var write_err error
+
+	for remaining > 0 {
+		size := sheet.reader.Size()
+
+		if remaining < size {
+			size = remaining
+		}
+
+		chunk, err := sheet.reader.Peek(size)
+
+		if err != nil {
+			sheet.fail()
+			return written, unexpectedEOF(err)
+		}
+
+		if write_err == nil {
+			var count int
+			count, write_err = writer.Write(chunk)
+			written += int64(count)
+		}
+
+		sheet.reader.Discard(len(chunk))
+		remaining -= len(chunk)
+	}
+
+	return written, write_err
+}
+
+// Reads exactly n bytes (at most 8) into the scratch buffer.
+func (sheet *sheetReader) read(n int) ([]byte, error) {
+	if err := sheet.consume(uint64(n)); err != nil {
+		return nil, err
+	}
+
+	data := sheet.buf[:n]
+
+	if _, err := io.ReadFull(sheet.reader, data); err != nil {
+		sheet.fail()
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Checks that a list of the supplied length is within the policy limit.
+func (sheet *sheetReader) checkPolicies(length uint32) error {
+	if sheet.max_policies != 0 && length > sheet.max_policies {
+		return sheet.reject()
+	}
+
+	return nil
+}
+
+// Counts n more bytes towards the response's size, rejecting the response
+// if that exceeds the limit.
+func (sheet *sheetReader) consume(n uint64) error {
+	sheet.response_size += n
+
+	if sheet.max_response_size != 0 && sheet.response_size > sheet.max_response_size {
+		return sheet.reject()
+	}
+
+	return nil
+}
+
+// Rejects a response which exceeds a limit. The rest of the response is
+// never read, so the connection can not be reused.
+func (sheet *sheetReader) reject() error {
+	sheet.fail()
+	return PaperErrorResponseTooLarge
+}
+
+// Marks the connection as broken after a failed read so that a partially
+// consumed response is never reused.
+func (sheet *sheetReader) fail() {
+	sheet.tcp_client.markBroken()
+}
+
+// A connection closed midway through a field is unexpected, not the end
+// of the stream.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
 }
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"io"
+	"net"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestReaderShortReads(t *testing.T) {
+	value := strings.Repeat("value", 2000)
+
+	writer := initSheetWriter()
+	writer.writeU8(7)
+	writer.writeU32(1234)
+	writer.writeU64(5678)
+	writer.writeString(value)
+	writer.writeString("")
+
+	reader := initFragmentedReader(t, writer.getBuf(), DefaultConfig())
+
+	u8, err := reader.readU8()
+
+	if err != nil || u8 != 7 {
+		t.Errorf("readU8 returned %d, %v", u8, err)
+	}
+
+	u32, err := reader.readU32()
+
+	if err != nil || u32 != 1234 {
+		t.Errorf("readU32 returned %d, %v", u32, err)
+	}
+
+	u64, err := reader.readU64()
+
+	if err != nil || u64 != 5678 {
+		t.Errorf("readU64 returned %d, %v", u64, err)
+	}
+
+	got, err := reader.readString()
+
+	if err != nil || got != value {
+		t.Errorf("readString returned %d bytes, %v", len(got), err)
+	}
+
+	got, err = reader.readString()
+
+	if err != nil || got != "" {
+		t.Errorf("readString returned %q, %v for an empty string", got, err)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	writer := initSheetWriter()
+	writer.writeU32(10)
+	writer.writeU8('a')
+
+	reader := initFragmentedReader(t, writer.getBuf(), DefaultConfig())
+
+	_, err := reader.readString()
+
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("readString of a truncated string returned %v", err)
+	}
+
+	if !reader.tcp_client.isBroken() {
+		t.Error("connection was not marked as broken after a truncated read")
+	}
+}
+
+func TestReaderValueLimit(t *testing.T) {
+	writer := initSheetWriter()
+	writer.writeString("long value")
+
+	config := DefaultConfig()
+	config.MaxValueSize = 4
+
+	reader := initFragmentedReader(t, writer.getBuf(), config)
+
+	_, err := reader.readString()
+
+	if err != PaperErrorResponseTooLarge {
+		t.Errorf("readString of a value exceeding the limit returned %v", err)
+	}
+
+	if !reader.tcp_client.isBroken() {
+		t.Error("connection was not closed after a value exceeded the limit")
+	}
+}
+
+func TestReaderResponseLimit(t *testing.T) {
+	writer := initSheetWriter()
+	writer.writeString("first")
+	writer.writeString("second")
+
+	config := DefaultConfig()
+	config.MaxResponseSize = 12
+
+	reader := initFragmentedReader(t, writer.getBuf(), config)
+	reader.startResponse()
+
+	if _, err := reader.readString(); err != nil {
+		t.Error("readString within the response limit returned an error")
+	}
+
+	_, err := reader.readString()
+
+	if err != PaperErrorResponseTooLarge {
+		t.Errorf("readString exceeding the response limit returned %v", err)
+	}
+
+	if !reader.tcp_client.isBroken() {
+		t.Error("connection was not closed after a response exceeded the limit")
+	}
+}
+
+func TestReaderPolicyLimit(t *testing.T) {
+	writer := initSheetWriter()
+	writer.writeU32(1)
+
+	for i := 0; i < 9; i++ {
+		writer.writeU64(0)
+	}
+
+	writer.writeU32(math.MaxUint32)
+
+	reader := initFragmentedReader(t, writer.getBuf(), DefaultConfig())
+
+	_, err := statusFromReader(reader)
+
+	if err != PaperErrorResponseTooLarge {
+		t.Errorf("status with too many policies returned %v", err)
+	}
+}
+
+// Gets a reader of the supplied data, which arrives one byte at a time
+// before the connection is closed.
+func initFragmentedReader(t *testing.T, data []byte, config Config) *sheetReader {
+	client_conn, server_conn := net.Pipe()
+
+	t.Cleanup(func() {
+		client_conn.Close()
+	})
+
+	go func() {
+		defer server_conn.Close()
+
+		for i := range data {
+			if _, err := server_conn.Write(data[i:i + 1]); err != nil {
+				return
+			}
+		}
+	}()
+
+	return initTcpClient(client_conn, &config).getReader()
+}
@@ -8,11 +8,23 @@
 package paperclient
 
 import (
+	"io"
 	"encoding/binary"
 )
 
 type sheetWriter struct {
 	buf []byte
+
+	// A value streamed from a reader when the sheet is sent, rather than
+	// being held in buf. It is written at stream_offset in buf.
+	stream io.Reader
+	stream_size uint32
+	stream_offset int
+	stream_started bool
+
+	// Set when the response is consumed in a way which can not be
+	// repeated, e.g. by streaming it to the caller's writer.
+	no_retry bool
 }
 
 func initSheetWriter() *sheetWriter {
@@ -46,3 +58,68 @@ func (sheet *sheetWriter) writeString(value string) {
 	sheet.writeU32(uint32(length))
 	sheet.buf = append(sheet.buf, value...)
 }
+
+func (sheet *sheetWriter) writeBytes(value []byte) {
+	length := len(value)
+	sheet.writeU32(uint32(length))
+	sheet.buf = append(sheet.buf, value...)
+}
+
+// Appends another sheet's requests, so that several can be sent at once.
+// The other sheet must not hold a stream.
+func (sheet *sheetWriter) writeSheet(other *sheetWriter) {
+	sheet.buf = append(sheet.buf, other.getBuf()...)
+}
+
+// Writes a length-prefixed value of the supplied size which is copied from
+// the reader as the sheet is sent. A sheet can hold at most one stream.
+func (sheet *sheetWriter) writeStream(reader io.Reader, size uint32) {
+	sheet.writeU32(size)
+
+	sheet.stream = reader
+	sheet.stream_size = size
+	sheet.stream_offset = len(sheet.buf)
+}
+
+// Writes the sheet to the supplied writer, copying any stream in place.
+func (sheet *sheetWriter) writeTo(writer io.Writer) error {
+	if sheet.stream == nil {
+		_, err := writer.Write(sheet.buf)
+		return err
+	}
+
+	if _, err := writer.Write(sheet.buf[:sheet.stream_offset]); err != nil {
+		return err
+	}
+
+	sheet.stream_started = true
+	_, err := io.CopyN(writer, sheet.stream, int64(sheet.stream_size))
+
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(sheet.buf[sheet.stream_offset:])
+	return err
+}
+
+// Checks if the sheet can be sent again after a failed send. A stream
+// can not be rewound once any of it has been read.
+func (sheet *sheetWriter) canResend() bool {
+	return !sheet.stream_started
+}
+
+// Prevents the command from being retried once it has been sent.
+func (sheet *sheetWriter) disableRetry() {
+	sheet.no_retry = true
+}
+
+// Checks if the command can be sent again after its response could not be
+// read.
+func (sheet *sheetWriter) canRetry() bool {
+	return !sheet.no_retry && sheet.canResend()
+}
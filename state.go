@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"sync/atomic"
+)
+
+// The state of a client's connection.
+type State uint32
+
+const (
+	// The client is establishing its first connection.
+	StateConnecting State = iota
+
+	// The connection is established and ready for commands.
+	StateReady
+
+	// The connection was lost or disconnected, and is reconnected by the
+	// next command (or in the background).
+	StateReconnecting
+
+	// The client was closed, and every command fails.
+	StateClosed
+)
+
+func (state State) String() string {
+	switch state {
+		case StateConnecting: return "connecting"
+		case StateReady: return "ready"
+		case StateReconnecting: return "reconnecting"
+		case StateClosed: return "closed"
+	}
+
+	return "unknown"
+}
+
+// Gets the state of the client's connection.
+func (client *PaperClient) State() State {
+	return State(atomic.LoadUint32(&client.state))
+}
+
+// Gets the state of the pool, which is ready if any of its connections
+// are ready, or otherwise reconnecting if any of them are.
+func (pool *PaperPool) State() State {
+	if pool.isClosed() {
+		return StateClosed
+	}
+
+	state := StateConnecting
+
+	for _, client := range pool.clients() {
+		switch client.State() {
+			case StateReady:
+				return StateReady
+
+			case StateReconnecting:
+				state = StateReconnecting
+		}
+	}
+
+	return state
+}
+
+// Moves to the supplied state unless the client is closed, returning the
+// previous state.
+func (client *PaperClient) transition(state State) State {
+	for {
+		prev := atomic.LoadUint32(&client.state)
+
+		if State(prev) == StateClosed {
+			return StateClosed
+		}
+
+		if atomic.CompareAndSwapUint32(&client.state, prev, uint32(state)) {
+			return State(prev)
+		}
+	}
+}
+
+// Records that the connection is ready.
+func (client *PaperClient) connected() {
+	if client.transition(StateReady) == StateReady {
+		return
+	}
+
+	if on_connect := client.config.Hooks.OnConnect; on_connect != nil {
+		on_connect(client.addr.host)
+	}
+}
+
+// Records that the connection was lost, with the error which broke it.
+func (client *PaperClient) lost(err error) {
+	if client.transition(StateReconnecting) != StateReady {
+		return
+	}
+
+	client.disconnected(err)
+}
+
+func (client *PaperClient) disconnected(err error) {
+	if on_disconnect := client.config.Hooks.OnDisconnect; on_disconnect != nil {
+		on_disconnect(err)
+	}
+}
+
+func (client *PaperClient) reconnected(attempt uint32, err error) {
+	if on_reconnect := client.config.Hooks.OnReconnect; on_reconnect != nil {
+		on_reconnect(attempt, err)
+	}
+
+	if err == nil {
+		client.connected()
+	}
+}
+
+// Records that authorizing failed if the server rejected the token.
+func (client *PaperClient) authFailed(err error) {
+	if err != PaperErrorUnauthorized {
+		return
+	}
+
+	if on_auth_failure := client.config.Hooks.OnAuthFailure; on_auth_failure != nil {
+		on_auth_failure(err)
+	}
+}
+
+// Copies the pool's configuration for its clients, replacing OnConnect and
+// OnDisconnect so that they are called when the pool as a whole becomes
+// ready or loses every ready connection, rather than each time the pool
+// opens or closes one of its connections.
+func (pool *PaperPool) clientConfig() *Config {
+	config := *pool.config
+
+	config.Hooks.OnConnect = pool.connected
+	config.Hooks.OnDisconnect = pool.disconnected
+
+	return &config
+}
+
+// Records that one of the pool's connections is ready.
+func (pool *PaperPool) connected(host string) {
+	if pool.isClosed() {
+		return
+	}
+
+	if State(atomic.SwapUint32(&pool.hook_state, uint32(StateReady))) == StateReady {
+		return
+	}
+
+	if on_connect := pool.config.Hooks.OnConnect; on_connect != nil {
+		on_connect(host)
+	}
+}
+
+// Records that one of the pool's connections was lost or closed. Closing
+// idle or expired connections leaves the pool without any (connecting
+// rather than reconnecting), which is not reported.
+func (pool *PaperPool) disconnected(err error) {
+	state := pool.State()
+
+	if state == StateReady || state == StateConnecting {
+		return
+	}
+
+	if State(atomic.SwapUint32(&pool.hook_state, uint32(state))) != StateReady {
+		return
+	}
+
+	if on_disconnect := pool.config.Hooks.OnDisconnect; on_disconnect != nil {
+		on_disconnect(err)
+	}
+}
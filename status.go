@@ -97,6 +97,10 @@ func statusFromReader(reader *sheetReader) (*PaperStatus, error) {
 		return nil, err
 	}
 
+	if err := reader.checkPolicies(num_policies); err != nil {
+		return nil, err
+	}
+
 	var policies []string
 
 	for i := uint32(0); i < num_policies; i++ {
@@ -8,39 +8,242 @@
 package paperclient
 
 import (
+	"os"
 	"net"
+	"sync"
+	"time"
 	"errors"
+	"context"
+	"sync/atomic"
 )
 
+// A deadline in the past, used to interrupt blocked reads and writes.
+var aLongTimeAgo = time.Unix(1, 0)
+
 type tcpClient struct {
-	conn *net.TCPConn
+	conn net.Conn
+	reader *sheetReader
+
+	// Set once the connection is unusable, accessed atomically since
+	// Disconnect may break the connection during an exchange.
+	broken uint32
+
+	read_timeout time.Duration
+	write_timeout time.Duration
+
+	// The deadline of the current exchange's context and whether that
+	// context has interrupted it. Guarded by deadline_lock since the
+	// context is watched from another goroutine.
+	deadline time.Time
+	interrupted bool
+	deadline_lock sync.Mutex
 }
 
-func tcpClientConnect(addr string) (*tcpClient, error) {
-	server, err := net.ResolveTCPAddr("tcp", addr)
+func tcpClientConnect(ctx context.Context, addr paperAddr, config *Config) (*tcpClient, error) {
+	ctx, cancel := withTimeout(ctx, config.dialTimeout())
+	defer cancel()
 
-	if err != nil {
-		return nil, errors.New("Invalid host or port.")
+	dial := config.Dialer
+
+	if dial == nil {
+		dial = defaultDialer(config)
 	}
 
-	conn, err := net.DialTCP("tcp", nil, server)
+	conn, err := dial(ctx, addr.network, addr.host)
 
 	if err != nil {
-		return nil, errors.New("Could not connect to server.")
+		if ctx_err := ctx.Err(); ctx_err != nil {
+			return nil, ctx_err
+		}
+
+		return nil, err
 	}
 
+	setBufferSizes(conn, config)
+
+	if addr.tls {
+		conn, err = tlsHandshake(ctx, conn, addr, config)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return initTcpClient(conn, config), nil
+}
+
+func initTcpClient(conn net.Conn, config *Config) *tcpClient {
 	client := tcpClient {
-		conn,
+		conn: conn,
+
+		read_timeout: config.ReadTimeout,
+		write_timeout: config.WriteTimeout,
 	}
 
-	return &client, nil
+	client.reader = initSheetReader(&client, config)
+
+	return &client
 }
 
-func (client *tcpClient) getConn() *net.TCPConn {
+func defaultDialer(config *Config) DialFunc {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		if network == "tcp" {
+			server, err := net.ResolveTCPAddr(network, addr)
+
+			if err != nil {
+				return nil, errors.New("Invalid host or port.")
+			}
+
+			addr = server.String()
+		}
+
+		dialer := net.Dialer {
+			KeepAlive: config.KeepAlive,
+		}
+
+		conn, err := dialer.DialContext(ctx, network, addr)
+
+		if err != nil {
+			return nil, errors.New("Could not connect to server.")
+		}
+
+		return conn, nil
+	}
+}
+
+func setBufferSizes(conn net.Conn, config *Config) {
+	buffered, ok := conn.(interface {
+		SetReadBuffer(bytes int) error
+		SetWriteBuffer(bytes int) error
+	})
+
+	if !ok {
+		return
+	}
+
+	if config.ReadBufferSize > 0 {
+		buffered.SetReadBuffer(config.ReadBufferSize)
+	}
+
+	if config.WriteBufferSize > 0 {
+		buffered.SetWriteBuffer(config.WriteBufferSize)
+	}
+}
+
+func (client *tcpClient) getConn() net.Conn {
 	return client.conn
 }
 
+// Gets the connection's reader. Responses must only be read through it
+// since it buffers data read from the connection.
+func (client *tcpClient) getReader() *sheetReader {
+	return client.reader
+}
+
 func (client *tcpClient) send(sheet *sheetWriter) (error) {
-	_, err := client.conn.Write(sheet.getBuf())
+	if client.write_timeout > 0 {
+		client.setIODeadline(client.conn.SetWriteDeadline, client.write_timeout)
+	}
+
+	err := sheet.writeTo(client.conn)
+
+	if err != nil {
+		client.markBroken()
+	}
+
+	return err
+}
+
+// Applies the read timeout to the response which is about to be read.
+func (client *tcpClient) startRead() {
+	if client.read_timeout > 0 {
+		client.setIODeadline(client.conn.SetReadDeadline, client.read_timeout)
+	}
+}
+
+// Sets a deadline the supplied timeout from now, or the context's deadline
+// if that is sooner, unless the exchange has already been interrupted.
+func (client *tcpClient) setIODeadline(set func(time.Time) error, timeout time.Duration) {
+	client.deadline_lock.Lock()
+	defer client.deadline_lock.Unlock()
+
+	if client.interrupted {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	if !client.deadline.IsZero() && client.deadline.Before(deadline) {
+		deadline = client.deadline
+	}
+
+	set(deadline)
+}
+
+// Applies the context's deadline to the connection and interrupts any
+// blocked read or write once the context is done. The returned function
+// must be called when the exchange is over.
+func (client *tcpClient) watch(ctx context.Context) func() {
+	deadline, _ := ctx.Deadline()
+
+	client.deadline_lock.Lock()
+	client.deadline = deadline
+	client.interrupted = false
+	client.conn.SetDeadline(deadline)
+	client.deadline_lock.Unlock()
+
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+			case <-ctx.Done():
+				client.deadline_lock.Lock()
+				client.interrupted = true
+				client.conn.SetDeadline(aLongTimeAgo)
+				client.deadline_lock.Unlock()
+
+			case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Marks the connection as unusable, for example after a partial read or
+// an interrupted write, so that it is replaced rather than reused.
+func (client *tcpClient) markBroken() {
+	atomic.StoreUint32(&client.broken, 1)
+	client.conn.Close()
+}
+
+func (client *tcpClient) isBroken() bool {
+	return atomic.LoadUint32(&client.broken) == 1
+}
+
+// Returns the context's error if the supplied I/O error was caused by the
+// context being cancelled or its deadline passing.
+func contextError(ctx context.Context, err error) error {
+	if ctx_err := ctx.Err(); ctx_err != nil {
+		return ctx_err
+	}
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		deadline, ok := ctx.Deadline()
+
+		if ok && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+	}
+
 	return err
 }
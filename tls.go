@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"net"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/sha256"
+)
+
+// Gets the SHA-256 hash of the certificate's SubjectPublicKeyInfo, which
+// can be passed to WithCertificatePins.
+func CertificatePin(cert *x509.Certificate) []byte {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hash[:]
+}
+
+func tlsHandshake(ctx context.Context, conn net.Conn, addr paperAddr, config *Config) (net.Conn, error) {
+	tls_conn := tls.Client(conn, buildTLSConfig(addr, config))
+
+	if err := tls_conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+
+		if ctx_err := ctx.Err(); ctx_err != nil {
+			return nil, ctx_err
+		}
+
+		return nil, err
+	}
+
+	return tls_conn, nil
+}
+
+func buildTLSConfig(addr paperAddr, config *Config) *tls.Config {
+	var tls_config *tls.Config
+
+	if config.TLSConfig != nil {
+		tls_config = config.TLSConfig.Clone()
+	} else {
+		tls_config = &tls.Config {}
+	}
+
+	if tls_config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr.host)
+
+		if err != nil {
+			host = addr.host
+		}
+
+		tls_config.ServerName = host
+	}
+
+	if len(config.CertificatePins) != 0 {
+		pins := config.CertificatePins
+		verify := tls_config.VerifyConnection
+
+		tls_config.VerifyConnection = func(state tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(state); err != nil {
+					return err
+				}
+			}
+
+			return verifyCertificatePins(state.PeerCertificates, pins)
+		}
+	}
+
+	return tls_config
+}
+
+func verifyCertificatePins(certs []*x509.Certificate, pins [][]byte) error {
+	for _, cert := range certs {
+		pin := CertificatePin(cert)
+
+		for _, expected := range pins {
+			if bytes.Equal(pin, expected) {
+				return nil
+			}
+		}
+	}
+
+	return PaperErrorCertificatePinMismatch
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) Kia Shakiba
+ *
+ * This source code is licensed under the GNU AGPLv3 license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package paperclient
+
+import (
+	"net"
+	"time"
+	"testing"
+	"math/big"
+	"crypto/tls"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+)
+
+func TestTLS(t *testing.T) {
+	server_cert := generateCertificate(t)
+	addr := initTLSServer(t, &tls.Config {
+		Certificates: []tls.Certificate { server_cert },
+	})
+
+	client, err := ClientConnect("paper+tls://" + addr, WithTLSConfig(&tls.Config {
+		RootCAs: certPool(server_cert),
+	}))
+
+	if err != nil {
+		t.Fatal("could not connect client over tls")
+	}
+
+	defer client.Disconnect()
+
+	client.Disconnect()
+	response, err := client.Ping()
+
+	if err != nil {
+		t.Error("ping returned an error after reconnecting over tls")
+	}
+
+	if response != "pong" {
+		t.Error("ping did not return pong after reconnecting over tls")
+	}
+}
+
+func TestTLSUntrusted(t *testing.T) {
+	server_cert := generateCertificate(t)
+	addr := initTLSServer(t, &tls.Config {
+		Certificates: []tls.Certificate { server_cert },
+	})
+
+	_, err := ClientConnect("papers://" + addr)
+
+	if err == nil {
+		t.Error("connecting to an untrusted server did not return an error")
+	}
+}
+
+func TestTLSMutual(t *testing.T) {
+	server_cert := generateCertificate(t)
+	client_cert := generateCertificate(t)
+
+	addr := initTLSServer(t, &tls.Config {
+		Certificates: []tls.Certificate { server_cert },
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs: certPool(client_cert),
+	})
+
+	_, err := ClientConnect("paper+tls://" + addr, WithTLSConfig(&tls.Config {
+		RootCAs: certPool(server_cert),
+	}))
+
+	if err == nil {
+		t.Error("connecting without a client certificate did not return an error")
+	}
+
+	client, err := ClientConnect("paper+tls://" + addr, WithTLSConfig(&tls.Config {
+		RootCAs: certPool(server_cert),
+		Certificates: []tls.Certificate { client_cert },
+	}))
+
+	if err != nil {
+		t.Fatal("could not connect client with a client certificate")
+	}
+
+	client.Disconnect()
+}
+
+func TestCertificatePins(t *testing.T) {
+	server_cert := generateCertificate(t)
+	other_cert := generateCertificate(t)
+
+	addr := initTLSServer(t, &tls.Config {
+		Certificates: []tls.Certificate { server_cert },
+	})
+
+	tls_config := &tls.Config {
+		RootCAs: certPool(server_cert),
+	}
+
+	client, err := ClientConnect(
+		"paper+tls://" + addr,
+		WithTLSConfig(tls_config),
+		WithCertificatePins(CertificatePin(server_cert.Leaf)),
+	)
+
+	if err != nil {
+		t.Fatal("could not connect client with a matching pin")
+	}
+
+	client.Disconnect()
+
+	_, err = ClientConnect(
+		"paper+tls://" + addr,
+		WithTLSConfig(tls_config),
+		WithCertificatePins(CertificatePin(other_cert.Leaf)),
+	)
+
+	if err != PaperErrorCertificatePinMismatch {
+		t.Error("connecting with a mismatched pin did not return correct error")
+	}
+}
+
+// Starts a TLS server which answers the first command on each connection
+// with a pong, returning its address.
+func initTLSServer(t *testing.T, config *tls.Config) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+
+	if err != nil {
+		t.Fatal("Could not start tls server")
+	}
+
+	serve(t, listener)
+
+	return listener.Addr().String()
+}
+
+// Generates a self-signed certificate which is valid for 127.0.0.1.
+func generateCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate {
+		SerialNumber: big.NewInt(1),
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+
+		IPAddresses: []net.IP { net.ParseIP("127.0.0.1") },
+
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage { x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth },
+
+		IsCA: true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate {
+		Certificate: [][]byte { der },
+		PrivateKey: key,
+		Leaf: leaf,
+	}
+}
+
+func certPool(cert tls.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	return pool
+}